@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Roles, each one can do everything the ones before it can. Viewers can
+// read, operators can also create, change and delete resources, admins can
+// also manage namespaces and quotas.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// Allows tells whether role grants what required does.
+func Allows(role string, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// Identity is who a request was authenticated as.
+type Identity struct {
+	Name string
+	Role string
+}
+
+// Token is a static API token and the identity it stands for.
+type Token struct {
+	Name  string
+	Token string
+	Role  string
+}
+
+// Authenticator checks the bearer tokens of requests against a list of
+// static tokens and, when Secret is set, JWTs signed with it.
+type Authenticator struct {
+	Tokens []Token
+	Secret []byte
+}
+
+var ErrUnauthenticated = errors.New("missing or invalid token")
+
+// Load reads the auth configuration, a YAML (or JSON) file like:
+//
+//	jwtSecret: change-me
+//	tokens:
+//	  - name: ci
+//	    token: 3f1c...
+//	    role: operator
+func Load(path string) (*Authenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	config := struct {
+		JWTSecret string
+		Tokens    []Token
+	}{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Authenticator{Tokens: config.Tokens}
+	if config.JWTSecret != "" {
+		a.Secret = []byte(config.JWTSecret)
+	}
+	for _, t := range a.Tokens {
+		if t.Name == "" || t.Token == "" {
+			return nil, fmt.Errorf("tokens need a name and a token")
+		}
+		if _, ok := roleRanks[t.Role]; !ok {
+			return nil, fmt.Errorf("token %s: unknown role %q", t.Name, t.Role)
+		}
+	}
+	if len(a.Tokens) == 0 && a.Secret == nil {
+		return nil, fmt.Errorf("%s has no tokens and no jwtSecret", path)
+	}
+	return a, nil
+}
+
+// Authenticate returns the identity of a token, static tokens are tried
+// before JWTs.
+func (a *Authenticator) Authenticate(token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	for _, t := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return &Identity{Name: t.Name, Role: t.Role}, nil
+		}
+	}
+	if a.Secret != nil && strings.Count(token, ".") == 2 {
+		id, err := VerifyJWT(a.Secret, token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+		}
+		return id, nil
+	}
+	return nil, ErrUnauthenticated
+}
+
+// BearerToken returns the token of the Authorization header of r.
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+type contextKey struct{}
+
+// FromContext returns the identity a request was authenticated as, nil
+// when authentication is off.
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
+
+// ReadOnly tells whether a request only reads. Besides GETs, POSTs to a
+// diff route only compare the body they send with what exists, it would
+// be too big for a query string.
+func ReadOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return path.Base(r.URL.Path) == "diff"
+	}
+	return false
+}
+
+// methodRole is the role a request needs unless its route asks for more,
+// reading needs a viewer and anything else an operator.
+func methodRole(r *http.Request) string {
+	if ReadOnly(r) {
+		return RoleViewer
+	}
+	return RoleOperator
+}
+
+// Middleware authenticates every request and checks its role against its
+// method. A nil Authenticator lets every request through, which keeps
+// clusters without an auth configuration working.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := a.Authenticate(BearerToken(r))
+		if err != nil {
+			log.Printf("refusing %s %s from %s: %v\n", r.Method, r.URL.Path, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, 401, err.Error())
+			return
+		}
+		if !Allows(id.Role, methodRole(r)) {
+			forbidden(w, r, id, methodRole(r))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	})
+}
+
+// Require is a middleware for routes that need more than their method
+// asks for. It lets requests through when authentication is off.
+func Require(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := FromContext(r.Context())
+			if id != nil && !Allows(id.Role, role) {
+				forbidden(w, r, id, role)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forbidden(w http.ResponseWriter, r *http.Request, id *Identity, role string) {
+	msg := fmt.Sprintf("%s (%s) can't %s %s, it needs the %s role", id.Name, id.Role, r.Method, r.URL.Path, role)
+	log.Println(msg)
+	writeError(w, 403, msg)
+}
+
+// writeError answers with the same body as the ErrResponse of the manager
+// and worker APIs.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		HTTPStatusCode int
+		Message        string
+	}{status, msg})
+}
+
+// Transport adds a bearer token to the requests it sends. When Hosts is
+// set only requests to the hosts it accepts get the token, so it isn't
+// leaked to third parties sharing the client.
+type Transport struct {
+	Base  http.RoundTripper
+	Token string
+	Hosts func(host string) bool
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Token == "" || (t.Hosts != nil && !t.Hosts(r.URL.Host)) {
+		return base.RoundTrip(r)
+	}
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.Token)
+	return base.RoundTrip(r)
+}
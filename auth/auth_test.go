@@ -0,0 +1,117 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/auth"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{auth.RoleViewer, auth.RoleViewer, true},
+		{auth.RoleViewer, auth.RoleOperator, false},
+		{auth.RoleOperator, auth.RoleViewer, true},
+		{auth.RoleOperator, auth.RoleAdmin, false},
+		{auth.RoleAdmin, auth.RoleAdmin, true},
+		{"", auth.RoleViewer, false},
+		{"root", auth.RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := auth.Allows(tt.role, tt.required); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, expected %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := &auth.Authenticator{
+		Tokens: []auth.Token{{Name: "ci", Token: "ci-token", Role: auth.RoleOperator}},
+		Secret: secret,
+	}
+
+	id, err := a.Authenticate("ci-token")
+	if err != nil || id.Name != "ci" || id.Role != auth.RoleOperator {
+		t.Fatalf("static token authenticated as %+v, %v", id, err)
+	}
+	id, err = a.Authenticate(sign(t, secret, auth.RoleAdmin))
+	if err != nil || id.Role != auth.RoleAdmin {
+		t.Fatalf("jwt authenticated as %+v, %v", id, err)
+	}
+	for _, token := range []string{"", "other-token", sign(t, []byte("other"), auth.RoleAdmin)} {
+		if id, err := a.Authenticate(token); err == nil {
+			t.Errorf("token %q authenticated as %+v", token, id)
+		}
+	}
+
+	// without a secret, JWTs are not accepted at all
+	a.Secret = nil
+	if id, err := a.Authenticate(sign(t, secret, auth.RoleAdmin)); err == nil {
+		t.Fatalf("jwt authenticated as %+v without a secret", id)
+	}
+}
+
+func TestMiddlewareChecksRoles(t *testing.T) {
+	a := &auth.Authenticator{Tokens: []auth.Token{
+		{Name: "viewer", Token: "viewer-token", Role: auth.RoleViewer},
+		{Name: "operator", Token: "operator-token", Role: auth.RoleOperator},
+		{Name: "admin", Token: "admin-token", Role: auth.RoleAdmin},
+	}}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromContext(r.Context()) == nil {
+			t.Error("authenticated request has no identity")
+		}
+		w.WriteHeader(200)
+	})
+	open := a.Middleware(ok)
+	admin := a.Middleware(auth.Require(auth.RoleAdmin)(ok))
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		token   string
+		want    int
+	}{
+		{"no token", open, "GET", "/tasks", "", 401},
+		{"unknown token", open, "GET", "/tasks", "nope", 401},
+		{"viewer reads", open, "GET", "/tasks", "viewer-token", 200},
+		{"viewer writes", open, "POST", "/tasks", "viewer-token", 403},
+		{"viewer diffs", open, "POST", "/manifests/diff", "viewer-token", 200},
+		{"viewer applies", open, "POST", "/manifests/apply", "viewer-token", 403},
+		{"operator writes", open, "DELETE", "/tasks", "operator-token", 200},
+		{"operator on an admin route", admin, "POST", "/tasks", "operator-token", 403},
+		{"admin on an admin route", admin, "POST", "/tasks", "admin-token", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("got status %d, expected %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilAuthenticatorLetsEveryoneIn(t *testing.T) {
+	var a *auth.Authenticator
+	h := a.Middleware(auth.Require(auth.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/namespaces", nil))
+	if w.Code != 200 {
+		t.Fatalf("got status %d without authentication, expected 200", w.Code)
+	}
+}
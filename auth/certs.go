@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"time"
+)
+
+// Kinds of certificates, the kind is the organizational unit of the
+// subject. Workers only accept manager certificates, the manager accepts
+// every certificate signed by the CA.
+const (
+	CertManager = "manager"
+	CertWorker  = "worker"
+	CertClient  = "client"
+)
+
+const organization = "cube"
+
+// NewCA returns the PEM encoded certificate and key of a self signed CA
+// valid for ttl.
+func NewCA(name string, ttl time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := certTemplate(name, ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encode(der, key)
+}
+
+// IssueCert returns the PEM encoded certificate and key of name, signed by
+// the CA. Manager and worker certificates can be used by servers and
+// clients, for the names and addresses in hosts, client ones only by
+// clients.
+func IssueCert(caCert, caKey []byte, name string, kind string, hosts []string, ttl time.Duration) ([]byte, []byte, error) {
+	ca, err := tls.X509KeyPair(caCert, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CA: %v", err)
+	}
+	ca.Leaf, err = x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := certTemplate(name, ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.Subject.OrganizationalUnit = []string{kind}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	switch kind {
+	case CertManager, CertWorker:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, h)
+			}
+		}
+	case CertClient:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	default:
+		return nil, nil, fmt.Errorf("unknown certificate kind %q", kind)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encode(der, key)
+}
+
+func certTemplate(name string, ttl time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{organization}},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(ttl),
+	}, nil
+}
+
+func encode(der []byte, key *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM, nil
+}
+
+func loadCA(caFile string, system bool) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if system {
+		if p, err := x509.SystemCertPool(); err == nil {
+			pool = p
+		}
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	return pool, nil
+}
+
+// ServerTLS returns the configuration of a server that only talks to
+// clients with a certificate signed by the CA and, when kinds are given,
+// of one of those kinds.
+func ServerTLS(caFile, certFile, keyFile string, kinds ...string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := loadCA(caFile, false)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(kinds) == 0 {
+				return nil
+			}
+			peer := cs.PeerCertificates[0]
+			for _, ou := range peer.Subject.OrganizationalUnit {
+				if slices.Contains(kinds, ou) {
+					return nil
+				}
+			}
+			return fmt.Errorf("certificate of %s is not a %v certificate", peer.Subject.CommonName, kinds)
+		},
+	}, nil
+}
+
+// RootsTLS returns the configuration of a client trusting the CA on top
+// of the system roots, without a certificate of its own.
+func RootsTLS(caFile string) (*tls.Config, error) {
+	pool, err := loadCA(caFile, true)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
+
+// ClientTLS returns the configuration of a client presenting its
+// certificate and trusting the CA, on top of the system roots so the same
+// client can still reach public servers.
+func ClientTLS(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := loadCA(caFile, true)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
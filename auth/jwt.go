@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims of the JWTs the manager accepts, the subject is the name of the
+// identity.
+type Claims struct {
+	Sub  string `json:"sub"`
+	Role string `json:"role"`
+	Iat  int64  `json:"iat"`
+	Exp  int64  `json:"exp,omitempty"`
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func sign(secret []byte, data string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignJWT returns an HS256 JWT for id, valid for ttl or forever when ttl
+// is 0.
+func SignJWT(secret []byte, id Identity, ttl time.Duration) (string, error) {
+	if _, ok := roleRanks[id.Role]; !ok {
+		return "", fmt.Errorf("unknown role %q", id.Role)
+	}
+	now := time.Now()
+	claims := Claims{Sub: id.Name, Role: id.Role, Iat: now.Unix()}
+	if ttl > 0 {
+		claims.Exp = now.Add(ttl).Unix()
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	data := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return data + "." + sign(secret, data), nil
+}
+
+// VerifyJWT checks the signature and expiry of an HS256 JWT and returns
+// the identity in its claims.
+func VerifyJWT(secret []byte, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed jwt")
+	}
+
+	header := struct{ Alg string }{}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil {
+		return nil, fmt.Errorf("malformed jwt header")
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", header.Alg)
+	}
+
+	expected := sign(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, fmt.Errorf("invalid jwt signature")
+	}
+
+	claims := Claims{}
+	data, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(data, &claims) != nil {
+		return nil, fmt.Errorf("malformed jwt claims")
+	}
+	if claims.Exp != 0 && time.Now().Unix() >= claims.Exp {
+		return nil, fmt.Errorf("jwt expired")
+	}
+	if _, ok := roleRanks[claims.Role]; !ok || claims.Sub == "" {
+		return nil, fmt.Errorf("jwt needs a sub and a known role")
+	}
+	return &Identity{Name: claims.Sub, Role: claims.Role}, nil
+}
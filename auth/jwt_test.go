@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/auth"
+)
+
+var secret = []byte("secret")
+
+func TestVerifyJWTAcceptsSignedTokens(t *testing.T) {
+	token, err := auth.SignJWT(secret, auth.Identity{Name: "ci", Role: auth.RoleOperator}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := auth.VerifyJWT(secret, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "ci" || id.Role != auth.RoleOperator {
+		t.Fatalf("token is for %+v, expected ci as an operator", id)
+	}
+}
+
+func TestVerifyJWTRejectsBadTokens(t *testing.T) {
+	valid, err := auth.SignJWT(secret, auth.Identity{Name: "ci", Role: auth.RoleViewer}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, ".")
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	claims := fmt.Sprintf(`{"sub":"ci","role":"viewer","iat":0,"exp":%d}`, time.Now().Add(-time.Minute).Unix())
+	expired := parts[0] + "." + encode(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(expired))
+	expired += "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other secret", sign(t, []byte("other"), auth.RoleViewer)},
+		{"expired", expired},
+		{"malformed", "not.a-jwt"},
+		{"tampered claims", parts[0] + "." + encode(`{"sub":"ci","role":"admin","iat":0}`) + "." + parts[2]},
+		{"no signature", parts[0] + "." + parts[1] + "."},
+		{"alg none", encode(`{"alg":"none","typ":"JWT"}`) + "." + parts[1] + "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if id, err := auth.VerifyJWT(secret, tt.token); err == nil {
+				t.Fatalf("token was accepted as %+v", id)
+			}
+		})
+	}
+}
+
+func TestSignJWTRejectsUnknownRoles(t *testing.T) {
+	_, err := auth.SignJWT(secret, auth.Identity{Name: "ci", Role: "root"}, 0)
+	if err == nil {
+		t.Fatal("signed a token for an unknown role")
+	}
+}
+
+func sign(t *testing.T, key []byte, role string) string {
+	t.Helper()
+	token, err := auth.SignJWT(key, auth.Identity{Name: "ci", Role: role}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
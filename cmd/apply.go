@@ -0,0 +1,134 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/spf13/cobra"
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update resources from a manifest.",
+	Long: `cube apply command.
+
+The apply command reads a YAML manifest, one or more documents separated by
+---, each with a kind (Task, Service or CronTask), a name and a spec. The
+resources that don't exist are created and the ones whose spec changed are
+updated, applying the same manifest twice changes nothing.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		changes := postManifests(cmd, "apply")
+		for _, c := range changes {
+			fmt.Printf("%s/%s %s\n", strings.ToLower(c.Kind), c.Name, c.Action)
+		}
+	},
+}
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the resources of a manifest.",
+	Long: `cube delete command.
+
+The delete command deletes the resources named in a YAML manifest.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		changes := postManifests(cmd, "delete")
+		for _, c := range changes {
+			fmt.Printf("%s/%s %s\n", strings.ToLower(c.Kind), c.Name, c.Action)
+		}
+	},
+}
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show what applying a manifest would change.",
+	Long: `cube diff command.
+
+The diff command shows, field by field, what cube apply would change for the
+resources of a YAML manifest without changing anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		changes := postManifests(cmd, "diff")
+		for _, c := range changes {
+			if c.Action == manager.ActionUnchanged {
+				continue
+			}
+			action := strings.TrimSuffix(c.Action, "d")
+			if c.Action == manager.ActionConfigured {
+				action = "update"
+			}
+			fmt.Printf("%s/%s (%s)\n", strings.ToLower(c.Kind), c.Name, action)
+			for _, line := range c.Diff {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+	},
+}
+
+// postManifests reads the manifest file given with -f, - meaning stdin,
+// and sends it to the manifests endpoint of the manager.
+func postManifests(cmd *cobra.Command, endpoint string) []manager.Change {
+	managerAddr, _ := cmd.Flags().GetString("manager")
+	filename, _ := cmd.Flags().GetString("filename")
+
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		log.Fatalf("Unable to read file %s: %v\n", filename, err)
+	}
+
+	manifests, err := manager.ParseManifests(data)
+	if err != nil {
+		log.Fatalf("Invalid manifest %s: %v\n", filename, err)
+	}
+	body, err := json.Marshal(manifests)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	url := fmt.Sprintf("%s://%s%s/manifests/%s", scheme(cmd), managerAddr, namespacePath(cmd), endpoint)
+	resp, err := apiClient(cmd).Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		log.Fatalf("Error connecting to %s %v\n", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		e := manager.ErrResponse{}
+		json.NewDecoder(resp.Body).Decode(&e)
+		log.Fatalf("Error (%d): %s\n", resp.StatusCode, e.Message)
+	}
+
+	var changes []manager.Change
+	err = json.NewDecoder(resp.Body).Decode(&changes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return changes
+}
+
+func init() {
+	for _, c := range []*cobra.Command{applyCmd, deleteCmd, diffCmd} {
+		rootCmd.AddCommand(c)
+		c.Flags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+		c.Flags().StringP("namespace", "n", "default", "Namespace to work in")
+		c.Flags().StringP("filename", "f", "", "Manifest to read, - for stdin")
+		c.MarkFlagRequired("filename")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/auth"
+	"github.com/spf13/cobra"
+)
+
+// certsCmd represents the certs command
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Certs command to create the certificates for mutual TLS.",
+	Long: `cube certs command.
+
+Creates a local CA and the certificates signed by it. Start the manager,
+the workers and the CLI with --tls-ca, --tls-cert and --tls-key to turn on
+mutual TLS, workers then only accept work from a manager certificate.
+
+	cube certs init
+	cube certs issue manager --kind manager --hosts manager.local,10.0.0.1
+	cube certs issue worker-1 --kind worker --hosts 10.0.0.2
+	cube certs issue alice --kind client`,
+}
+
+var certsInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the CA, ca.crt and ca.key.",
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+		if _, err := os.Stat(keyFile); err == nil {
+			log.Fatalf("%s already exists\n", keyFile)
+		}
+		cert, key, err := auth.NewCA("cube CA", ttl)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeCert(dir, certFile, cert, keyFile, key)
+	},
+}
+
+var certsIssueCmd = &cobra.Command{
+	Use:   "issue NAME",
+	Short: "Issue a manager, worker or client certificate, NAME.crt and NAME.key.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		kind, _ := cmd.Flags().GetString("kind")
+		hosts, _ := cmd.Flags().GetStringSlice("hosts")
+
+		caCert, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+		if err != nil {
+			log.Fatalf("Unable to read the CA, run cube certs init first: %v\n", err)
+		}
+		caKey, err := os.ReadFile(filepath.Join(dir, "ca.key"))
+		if err != nil {
+			log.Fatalf("Unable to read the CA key: %v\n", err)
+		}
+
+		cert, key, err := auth.IssueCert(caCert, caKey, args[0], kind, hosts, ttl)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeCert(dir, filepath.Join(dir, args[0]+".crt"), cert, filepath.Join(dir, args[0]+".key"), key)
+	},
+}
+
+func writeCert(dir string, certFile string, cert []byte, keyFile string, key []byte) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(certFile, cert, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, key, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %s and %s\n", certFile, keyFile)
+}
+
+func init() {
+	rootCmd.AddCommand(certsCmd)
+	certsCmd.AddCommand(certsInitCmd)
+	certsCmd.AddCommand(certsIssueCmd)
+
+	certsCmd.PersistentFlags().String("dir", "certs", "Directory of the CA and the certificates")
+	certsInitCmd.Flags().Duration("ttl", 10*365*24*time.Hour, "How long the CA is valid")
+	certsIssueCmd.Flags().Duration("ttl", 365*24*time.Hour, "How long the certificate is valid")
+	certsIssueCmd.Flags().String("kind", auth.CertClient, "Kind of certificate, manager, worker or client")
+	certsIssueCmd.Flags().StringSlice("hosts", []string{"localhost", "127.0.0.1"}, "Names and addresses the manager or worker is reached at")
+}
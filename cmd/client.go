@@ -0,0 +1,107 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/jhonnyV-V/orch-in-go/auth"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// cliConfig is read from ~/.cube/config.yaml, or the file in CUBE_CONFIG.
+type cliConfig struct {
+	Token string `yaml:"token"`
+	CA    string `yaml:"ca"`
+	Cert  string `yaml:"cert"`
+	Key   string `yaml:"key"`
+}
+
+func loadCliConfig() cliConfig {
+	config := cliConfig{}
+	path := os.Getenv("CUBE_CONFIG")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return config
+		}
+		path = filepath.Join(home, ".cube", "config.yaml")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config
+	}
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		log.Printf("ignoring invalid config %s: %v\n", path, err)
+		return cliConfig{}
+	}
+	return config
+}
+
+// apiToken returns the token to talk to the manager with, from --token,
+// the CUBE_TOKEN variable or the token of the config file, in that order.
+func apiToken(cmd *cobra.Command) string {
+	if token, _ := cmd.Flags().GetString("token"); token != "" {
+		return token
+	}
+	if token := os.Getenv("CUBE_TOKEN"); token != "" {
+		return token
+	}
+	return loadCliConfig().Token
+}
+
+// tlsFlags returns the CA, certificate and key given with the --tls-*
+// flags. TLS is off when there is no CA.
+func tlsFlags(cmd *cobra.Command) (string, string, string) {
+	ca, _ := cmd.Flags().GetString("tls-ca")
+	cert, _ := cmd.Flags().GetString("tls-cert")
+	key, _ := cmd.Flags().GetString("tls-key")
+	return ca, cert, key
+}
+
+// tlsFiles is tlsFlags falling back to the files of the config file, for
+// the commands talking to the manager.
+func tlsFiles(cmd *cobra.Command) (string, string, string) {
+	ca, cert, key := tlsFlags(cmd)
+	if ca == "" {
+		config := loadCliConfig()
+		ca, cert, key = config.CA, config.Cert, config.Key
+	}
+	return ca, cert, key
+}
+
+func scheme(cmd *cobra.Command) string {
+	if ca, _, _ := tlsFiles(cmd); ca != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// clientTransport returns a transport presenting cert and trusting ca, or
+// the default transport when TLS is off.
+func clientTransport(ca, cert, key string) http.RoundTripper {
+	if ca == "" {
+		return http.DefaultTransport
+	}
+	config, err := auth.ClientTLS(ca, cert, key)
+	if err != nil {
+		log.Fatalf("Unable to load TLS certificates: %v\n", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return transport
+}
+
+// apiClient returns a client for the manager API, sending the token of
+// apiToken with every request.
+func apiClient(cmd *cobra.Command) *http.Client {
+	return &http.Client{
+		Transport: &auth.Transport{Base: clientTransport(tlsFiles(cmd)), Token: apiToken(cmd)},
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/spf13/cobra"
+)
+
+// cronCmd represents the cron command
+var cronCmd = &cobra.Command{
+	Use:   "cron",
+	Short: "Cron command to list cron tasks.",
+	Long: `cube cron command.
+
+The cron command lists the cron tasks known by the manager, when they last
+ran and when they will run next.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s%s/crontasks", scheme(cmd), managerAddr, namespacePath(cmd))
+		resp, err := apiClient(cmd).Get(url)
+		if err != nil {
+			log.Fatalf("Failed to get cron tasks from %s %v\n", url, err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var cronTasks []*manager.CronTask
+		err = json.Unmarshal(body, &cronTasks)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "ID\tNAME\tSCHEDULE\tCONCURRENCY\tSUSPENDED\tLAST\tNEXT\tRUNS\t")
+		for _, c := range cronTasks {
+			last := "never"
+			if !c.LastScheduleTime.IsZero() {
+				last = c.LastScheduleTime.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%s\t%t\t%s\t%s\t%d\t\n",
+				c.ID,
+				c.Name,
+				c.Schedule,
+				c.ConcurrencyPolicy,
+				c.Suspend,
+				last,
+				c.NextScheduleTime.Local().Format("2006-01-02 15:04:05"),
+				len(c.Runs),
+			)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cronCmd)
+
+	cronCmd.Flags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	cronCmd.Flags().StringP("namespace", "n", "default", "Namespace to work in")
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/jhonnyV-V/orch-in-go/utils"
+	"github.com/jhonnyV-V/orch-in-go/worker"
+	"github.com/spf13/cobra"
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec TASK -- COMMAND [ARGS...]",
+	Short: "Run a command inside a running task.",
+	Long: `cube exec command.
+
+The exec command runs a command inside the container of a running task,
+going through the manager so there is no need to know which worker runs it.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		tty, _ := cmd.Flags().GetBool("tty")
+
+		data, err := json.Marshal(worker.ExecRequest{
+			Cmd:   args[1:],
+			Tty:   tty,
+			Stdin: interactive,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		url := fmt.Sprintf("%s://%s%s/tasks/%s/exec", scheme(cmd), manager, namespacePath(cmd), args[0])
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("Error creating request %s %v\n", url, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", utils.ExecProtocol)
+
+		resp, err := apiClient(cmd).Do(req)
+		if err != nil {
+			log.Fatalf("Error connecting to %s %v\n", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			body, _ := io.ReadAll(resp.Body)
+			log.Fatalf("Error starting exec (%d): %s\n", resp.StatusCode, body)
+		}
+		conn, ok := resp.Body.(io.ReadWriteCloser)
+		if !ok {
+			log.Fatal("Connection can't be used for exec")
+		}
+
+		mu := &sync.Mutex{}
+		go func() {
+			if interactive {
+				io.Copy(&utils.FrameWriter{W: conn, Stream: utils.StreamStdin, Mu: mu}, os.Stdin)
+			}
+			// an empty stdin frame tells the other side there is no more input
+			mu.Lock()
+			utils.WriteFrame(conn, utils.StreamStdin, nil)
+			mu.Unlock()
+		}()
+
+		for {
+			stream, p, err := utils.ReadFrame(conn)
+			if err != nil {
+				log.Fatalf("Connection closed before the command finished: %v\n", err)
+			}
+			switch stream {
+			case utils.StreamStdout:
+				os.Stdout.Write(p)
+			case utils.StreamStderr:
+				os.Stderr.Write(p)
+			case utils.StreamExit:
+				code, _ := strconv.Atoi(string(p))
+				conn.Close()
+				os.Exit(code)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	execCmd.Flags().StringP("namespace", "n", "default", "Namespace to work in")
+	execCmd.Flags().BoolP("interactive", "i", false, "Send stdin to the command")
+	execCmd.Flags().BoolP("tty", "t", false, "Allocate a tty for the command")
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Print the logs of a task.",
+	Long: `cube logs command.
+
+The logs command prints the output of a task, fetched from the worker running it.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		follow, _ := cmd.Flags().GetBool("follow")
+		tail, _ := cmd.Flags().GetString("tail")
+		since, _ := cmd.Flags().GetString("since")
+
+		query := url.Values{}
+		if follow {
+			query.Set("follow", "true")
+		}
+		query.Set("tail", tail)
+		if since != "" {
+			query.Set("since", since)
+		}
+
+		url := fmt.Sprintf("%s://%s%s/tasks/%s/logs?%s", scheme(cmd), manager, namespacePath(cmd), args[0], query.Encode())
+		resp, err := apiClient(cmd).Get(url)
+		if err != nil {
+			log.Fatalf("Error connecting to %s %v\n", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			log.Fatalf("Error getting logs (%d): %s\n", resp.StatusCode, body)
+		}
+
+		io.Copy(os.Stdout, resp.Body)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	logsCmd.Flags().StringP("namespace", "n", "default", "Namespace to work in")
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep streaming new output")
+	logsCmd.Flags().String("tail", "all", "Number of lines to show from the end of the logs")
+	logsCmd.Flags().String("since", "", "Only show logs since a timestamp or relative duration (e.g. 10m)")
+}
@@ -6,7 +6,10 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"time"
 
+	"github.com/jhonnyV-V/orch-in-go/auth"
 	"github.com/jhonnyV-V/orch-in-go/manager"
 	"github.com/spf13/cobra"
 )
@@ -29,19 +32,68 @@ The manager controls the orchestration system and is reponsible for:
 		workers, _ := cmd.Flags().GetStringSlice("workers")
 		scheduler, _ := cmd.Flags().GetString("scheduler")
 		dbtype, _ := cmd.Flags().GetString("dbtype")
+		admissionConfig, _ := cmd.Flags().GetString("admission-config")
+		webhookCA, _ := cmd.Flags().GetString("webhook-ca")
+		authConfig, _ := cmd.Flags().GetString("auth-config")
+		workerToken, _ := cmd.Flags().GetString("worker-token")
+		joinTokens, _ := cmd.Flags().GetStringSlice("join-token")
+		rescheduleAfter, _ := cmd.Flags().GetDuration("reschedule-after")
 
 		m := manager.New(workers, scheduler, dbtype)
+		if admissionConfig != "" {
+			webhooks, err := manager.LoadWebhooks(admissionConfig)
+			if err != nil {
+				log.Fatalf("Unable to load admission config %s: %v\n", admissionConfig, err)
+			}
+			m.Webhooks = webhooks
+		}
+		if webhookCA != "" {
+			config, err := auth.RootsTLS(webhookCA)
+			if err != nil {
+				log.Fatalf("Unable to load webhook CA %s: %v\n", webhookCA, err)
+			}
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = config
+			m.WebhookClient.Transport = transport
+		}
+		m.JoinTokens = joinTokens
+		m.RescheduleAfter = rescheduleAfter
 		api := manager.Api{
 			Address: host,
 			Port:    port,
 			Manager: m,
 		}
+		proto := "http"
+		ca, cert, key := tlsFlags(cmd)
+		if ca != "" {
+			proto = "https"
+			config, err := auth.ServerTLS(ca, cert, key)
+			if err != nil {
+				log.Fatalf("Unable to load TLS certificates: %v\n", err)
+			}
+			api.TLS = config
+			m.UseTLS()
+		}
+		m.Client = &http.Client{
+			Transport: &auth.Transport{Base: clientTransport(ca, cert, key), Token: workerToken, Hosts: m.IsWorker},
+			Timeout:   manager.WorkerTimeout,
+		}
+		if authConfig != "" {
+			authenticator, err := auth.Load(authConfig)
+			if err != nil {
+				log.Fatalf("Unable to load auth config %s: %v\n", authConfig, err)
+			}
+			api.Auth = authenticator
+		}
 
 		go m.ProcessTasks()
 		go m.UpdateTasks()
 		go m.DoHealthChecks()
+		go m.ProcessCronTasks()
+		go m.ProcessWorkflows()
+		go m.ProcessServices()
 
-		log.Printf("Starting manager API on http://%s:%d\n", host, port)
+		log.Printf("Starting manager API on %s://%s:%d\n", proto, host, port)
 		api.Start()
 	},
 }
@@ -64,4 +116,18 @@ func init() {
 		"memory",
 		"Type of data store to use for tasks (\"memory\" or \"persistent\")",
 	)
+	managerCmd.Flags().String(
+		"admission-config",
+		"",
+		"YAML file listing the admission webhooks called before tasks are accepted",
+	)
+	managerCmd.Flags().String("webhook-ca", "", "CA trusted for https webhooks on top of the system roots")
+	managerCmd.Flags().String(
+		"auth-config",
+		"",
+		"YAML file with the API tokens and JWT secret, the API is open without it",
+	)
+	managerCmd.Flags().String("worker-token", "", "Token sent to the workers, it needs the admin role for tasks reaching into the hosts (exec, bind mounts, wasm from the host)")
+	managerCmd.Flags().StringSlice("join-token", nil, "Tokens workers can join with (cube worker --join)")
+	managerCmd.Flags().Duration("reschedule-after", 5*time.Minute, "How long a worker can be down before its tasks are rescheduled")
 }
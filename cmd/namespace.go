@@ -0,0 +1,122 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/spf13/cobra"
+)
+
+// namespacePath returns the prefix of the manager routes for the namespace
+// given with --namespace, the default namespace is served at the root.
+func namespacePath(cmd *cobra.Command) string {
+	ns, _ := cmd.Flags().GetString("namespace")
+	if ns == "" || ns == manager.DefaultNamespace {
+		return ""
+	}
+	return "/namespaces/" + ns
+}
+
+// namespaceCmd represents the namespace command
+var namespaceCmd = &cobra.Command{
+	Use:   "namespace",
+	Short: "Namespace command to manage namespaces.",
+	Long: `cube namespace command.
+
+Namespaces group tasks, services, cron tasks and workflows. Names only need
+to be unique within a namespace, and deleting a namespace deletes everything
+in it. Other commands pick a namespace with --namespace.`,
+}
+
+var namespaceCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a namespace.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s/namespaces", scheme(cmd), managerAddr)
+		data, _ := json.Marshal(manager.Namespace{Name: args[0]})
+		resp, err := apiClient(cmd).Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("Failed to create namespace at %s %v\n", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			body, _ := io.ReadAll(resp.Body)
+			log.Fatalf("Failed to create namespace %s: %s\n", args[0], body)
+		}
+		fmt.Printf("namespace/%s created\n", args[0])
+	},
+}
+
+var namespaceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List namespaces.",
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s/namespaces", scheme(cmd), managerAddr)
+		resp, err := apiClient(cmd).Get(url)
+		if err != nil {
+			log.Fatalf("Failed to get namespaces from %s %v\n", url, err)
+		}
+		defer resp.Body.Close()
+
+		var namespaces []*manager.Namespace
+		err = json.NewDecoder(resp.Body).Decode(&namespaces)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "NAME\tCREATED\t")
+		for _, n := range namespaces {
+			fmt.Fprintf(w, "%s\t%s\t\n", n.Name, n.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	},
+}
+
+var namespaceDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "Delete a namespace and everything in it.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s/namespaces/%s", scheme(cmd), managerAddr, args[0])
+		req, err := http.NewRequest("DELETE", url, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		resp, err := apiClient(cmd).Do(req)
+		if err != nil {
+			log.Fatalf("Failed to delete namespace at %s %v\n", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			body, _ := io.ReadAll(resp.Body)
+			log.Fatalf("Failed to delete namespace %s: %s\n", args[0], body)
+		}
+		fmt.Printf("namespace/%s deleted\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(namespaceCmd)
+	namespaceCmd.AddCommand(namespaceCreateCmd)
+	namespaceCmd.AddCommand(namespaceListCmd)
+	namespaceCmd.AddCommand(namespaceDeleteCmd)
+
+	namespaceCmd.PersistentFlags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+}
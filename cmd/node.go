@@ -8,10 +8,11 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"text/tabwriter"
+	"time"
 
+	"github.com/docker/go-units"
 	"github.com/jhonnyV-V/orch-in-go/node"
 	"github.com/spf13/cobra"
 )
@@ -26,8 +27,8 @@ The node command allows the user to get information about the nodes in the clust
 	Run: func(cmd *cobra.Command, args []string) {
 		manager, _ := cmd.Flags().GetString("manager")
 
-		url := fmt.Sprintf("http://%s/nodes", manager)
-		resp, err := http.Get(url)
+		url := fmt.Sprintf("%s://%s/nodes", scheme(cmd), manager)
+		resp, err := apiClient(cmd).Get(url)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -46,12 +47,18 @@ The node command allows the user to get information about the nodes in the clust
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
-		fmt.Fprintln(w, "NAME\tMEMORY (MiB)\tDISK (GiB)\tROLE\tTASKS\t")
+		fmt.Fprintln(w, "NAME\tSTATUS\tLAST SEEN\tMEMORY (MiB)\tDISK (GiB)\tROLE\tTASKS\t")
 		for _, n := range nodes {
+			lastSeen := "never"
+			if !n.LastSeen.IsZero() {
+				lastSeen = fmt.Sprintf("%s ago", units.HumanDuration(time.Since(n.LastSeen)))
+			}
 			fmt.Fprintf(
 				w,
-				"%s\t%d\t%d\t%s\t%d\t\n",
+				"%s\t%s\t%s\t%d\t%d\t%s\t%d\t\n",
 				n.Name,
+				n.Status,
+				lastSeen,
 				n.Memory/1000,
 				n.Disk/1000/1000/1000,
 				n.Role,
@@ -0,0 +1,132 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/spf13/cobra"
+)
+
+// quotaCmd represents the quota command
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Quota command to show the quota of a namespace.",
+	Long: `cube quota command.
+
+The quota command shows the limits of a namespace next to what its
+scheduled and running tasks use, and what its pending tasks ask for.
+A limit of 0 means no limit.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s%s/quota", scheme(cmd), managerAddr, namespacePath(cmd))
+		resp, err := apiClient(cmd).Get(url)
+		if err != nil {
+			log.Fatalf("Failed to get quota from %s %v\n", url, err)
+		}
+		printQuota(resp)
+	},
+}
+
+var quotaSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the quota of a namespace.",
+	Long: `cube quota set command.
+
+Sets every limit of the quota of a namespace, limits left out are removed.
+With --policy Reject tasks that don't fit are refused, with Queue they wait
+as pending until enough tasks of the namespace finish.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		cpu, _ := cmd.Flags().GetFloat64("cpu")
+		tasks, _ := cmd.Flags().GetInt("tasks")
+		policy, _ := cmd.Flags().GetString("policy")
+		quota := manager.Quota{Cpu: cpu, Tasks: tasks, Policy: policy}
+		for flag, limit := range map[string]*int64{"memory": &quota.Memory, "disk": &quota.Disk} {
+			value, _ := cmd.Flags().GetString(flag)
+			if value == "" {
+				continue
+			}
+			n, err := units.RAMInBytes(value)
+			if err != nil {
+				log.Fatalf("Invalid --%s %s: %v\n", flag, value, err)
+			}
+			*limit = n
+		}
+
+		data, _ := json.Marshal(quota)
+		url := fmt.Sprintf("%s://%s%s/quota", scheme(cmd), managerAddr, namespacePath(cmd))
+		req, err := http.NewRequest("PUT", url, bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := apiClient(cmd).Do(req)
+		if err != nil {
+			log.Fatalf("Failed to set quota at %s %v\n", url, err)
+		}
+		printQuota(resp)
+	},
+}
+
+func printQuota(resp *http.Response) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Fatalf("Error (%d): %s\n", resp.StatusCode, body)
+	}
+
+	status := manager.QuotaStatus{}
+	err := json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	policy := status.Limits.Policy
+	if policy == "" {
+		policy = manager.QuotaReject
+	}
+	fmt.Printf("Namespace: %s\nPolicy:    %s\n\n", status.Namespace, policy)
+
+	limit := func(value string, set bool) string {
+		if !set {
+			return "none"
+		}
+		return value
+	}
+	size := func(n int64) string {
+		return units.BytesSize(float64(n))
+	}
+
+	l, u, p := status.Limits, status.Used, status.Pending
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "RESOURCE\tUSED\tPENDING\tLIMIT\t")
+	fmt.Fprintf(w, "cpu\t%g\t%g\t%s\t\n", u.Cpu, p.Cpu, limit(fmt.Sprintf("%g", l.Cpu), l.Cpu > 0))
+	fmt.Fprintf(w, "memory\t%s\t%s\t%s\t\n", size(u.Memory), size(p.Memory), limit(size(l.Memory), l.Memory > 0))
+	fmt.Fprintf(w, "disk\t%s\t%s\t%s\t\n", size(u.Disk), size(p.Disk), limit(size(l.Disk), l.Disk > 0))
+	fmt.Fprintf(w, "tasks\t%d\t%d\t%s\t\n", u.Tasks, p.Tasks, limit(fmt.Sprintf("%d", l.Tasks), l.Tasks > 0))
+	w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(quotaCmd)
+	quotaCmd.AddCommand(quotaSetCmd)
+
+	quotaCmd.PersistentFlags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	quotaCmd.PersistentFlags().StringP("namespace", "n", "default", "Namespace to work in")
+	quotaSetCmd.Flags().Float64("cpu", 0, "Total cpu of the namespace's tasks")
+	quotaSetCmd.Flags().String("memory", "", "Total memory of the namespace's tasks (e.g. 4g)")
+	quotaSetCmd.Flags().String("disk", "", "Total disk of the namespace's tasks (e.g. 20g)")
+	quotaSetCmd.Flags().Int("tasks", 0, "Number of active tasks in the namespace")
+	quotaSetCmd.Flags().String("policy", manager.QuotaReject, "What to do with tasks over quota, Reject or Queue")
+}
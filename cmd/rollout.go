@@ -0,0 +1,114 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/spf13/cobra"
+)
+
+// rolloutCmd represents the rollout command
+var rolloutCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Manage the rollout of a service.",
+	Long: `cube rollout command.
+
+The rollout command shows how the update of a service is going, lists its
+revisions and can bring the previous one back.`,
+}
+
+var rolloutStatusCmd = &cobra.Command{
+	Use:   "status SERVICE",
+	Short: "Show the rollout status of a service.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s%s/services/%s", scheme(cmd), managerAddr, namespacePath(cmd), args[0])
+		s := serviceFromResponse(apiClient(cmd).Get(url))
+		fmt.Printf("revision %d: %s", s.Revision, s.Rollout.State)
+		if s.Rollout.Phase != "" {
+			fmt.Printf("/%s", s.Rollout.Phase)
+		}
+		if s.Rollout.Message != "" {
+			fmt.Printf(" (%s)", s.Rollout.Message)
+		}
+		fmt.Println()
+	},
+}
+
+var rolloutHistoryCmd = &cobra.Command{
+	Use:   "history SERVICE",
+	Short: "List the revisions of a service.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s%s/services/%s", scheme(cmd), managerAddr, namespacePath(cmd), args[0])
+		s := serviceFromResponse(apiClient(cmd).Get(url))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "REVISION\tIMAGE\tCREATED\tCURRENT\t")
+		for _, r := range s.History {
+			current := ""
+			if r.Revision == s.Revision {
+				current = "*"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t\n", r.Revision, r.Template.Image, r.CreatedAt.Format("2006-01-02 15:04:05"), current)
+		}
+		w.Flush()
+	},
+}
+
+var rolloutUndoCmd = &cobra.Command{
+	Use:   "undo SERVICE",
+	Short: "Roll a service back to its previous revision.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s%s/services/%s/rollout/undo", scheme(cmd), managerAddr, namespacePath(cmd), args[0])
+		s := serviceFromResponse(apiClient(cmd).Post(url, "application/json", nil))
+		log.Printf("Service %s is rolling back to revision %d\n", s.Name, s.Revision)
+	},
+}
+
+func serviceFromResponse(resp *http.Response, err error) *manager.Service {
+	if err != nil {
+		log.Fatalf("Error connecting to the manager %v\n", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := manager.ErrResponse{}
+		json.Unmarshal(body, &e)
+		log.Fatalf("Error (%d): %s\n", resp.StatusCode, e.Message)
+	}
+
+	s := manager.Service{}
+	err = json.Unmarshal(body, &s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &s
+}
+
+func init() {
+	rootCmd.AddCommand(rolloutCmd)
+	rolloutCmd.AddCommand(rolloutStatusCmd)
+	rolloutCmd.AddCommand(rolloutHistoryCmd)
+	rolloutCmd.AddCommand(rolloutUndoCmd)
+
+	rolloutCmd.PersistentFlags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	rolloutCmd.PersistentFlags().StringP("namespace", "n", "default", "Namespace to work in")
+}
@@ -39,6 +39,10 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.orch-in-go.yaml)")
+	rootCmd.PersistentFlags().String("token", "", "API token, defaults to $CUBE_TOKEN or the token of ~/.cube/config.yaml")
+	rootCmd.PersistentFlags().String("tls-ca", "", "CA certificate, turns on mutual TLS (see cube certs)")
+	rootCmd.PersistentFlags().String("tls-cert", "", "Certificate presented to the other side")
+	rootCmd.PersistentFlags().String("tls-key", "", "Key of --tls-cert")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/jhonnyV-V/orch-in-go/manager"
 	"github.com/spf13/cobra"
 )
 
@@ -29,7 +31,7 @@ var runCmd = &cobra.Command{
 
 The run command starts a new task`,
 	Run: func(cmd *cobra.Command, args []string) {
-		manager, _ := cmd.Flags().GetString("manager")
+		managerAddr, _ := cmd.Flags().GetString("manager")
 		filename, _ := cmd.Flags().GetString("filename")
 
 		fullFilePath, err := filepath.Abs(filename)
@@ -41,7 +43,7 @@ The run command starts a new task`,
 			log.Fatalf("File %s does not exist.\n", filename)
 		}
 
-		log.Printf("Using manager: %v\n", manager)
+		log.Printf("Using manager: %v\n", managerAddr)
 		log.Printf("Using file %v\n", fullFilePath)
 
 		data, err := os.ReadFile(fullFilePath)
@@ -50,16 +52,24 @@ The run command starts a new task`,
 		}
 		log.Printf("Data: %v\n", string(data))
 
-		url := fmt.Sprintf("http://%s/tasks", manager)
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+		url := fmt.Sprintf("%s://%s%s/tasks", scheme(cmd), managerAddr, namespacePath(cmd))
+		resp, err := apiClient(cmd).Post(url, "application/json", bytes.NewBuffer(data))
 		if err != nil {
 			log.Panic(err)
 		}
+		defer resp.Body.Close()
 		if resp.StatusCode != http.StatusCreated {
+			e := manager.ValidationErrResponse{}
+			json.NewDecoder(resp.Body).Decode(&e)
 			log.Printf("error sending request %v\n", resp.StatusCode)
+			if len(e.Errors) == 0 {
+				log.Println(e.Message)
+			}
+			for _, fe := range e.Errors {
+				log.Printf("  %s\n", fe)
+			}
 			return
 		}
-		defer resp.Body.Close()
 		log.Println("Successfully sent task request to manager")
 	},
 }
@@ -68,5 +78,6 @@ func init() {
 	rootCmd.AddCommand(runCmd)
 
 	runCmd.Flags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	runCmd.Flags().StringP("namespace", "n", "default", "Namespace to work in")
 	runCmd.Flags().StringP("filename", "f", "task.json", "Task specification file")
 }
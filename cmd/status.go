@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"text/tabwriter"
 	"time"
@@ -28,8 +27,8 @@ The cube command allows a user to get the status of tasks from the Cube manager`
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("status called")
 		manager, _ := cmd.Flags().GetString("manager")
-		url := fmt.Sprintf("http://%s/tasks", manager)
-		resp, err := http.Get(url)
+		url := fmt.Sprintf("%s://%s%s/tasks", scheme(cmd), manager, namespacePath(cmd))
+		resp, err := apiClient(cmd).Get(url)
 		if err != nil {
 			log.Printf("Failed to get tasks from %s %v\n", url, err)
 		}
@@ -47,7 +46,7 @@ The cube command allows a user to get the status of tasks from the Cube manager`
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
 
-		fmt.Fprintln(w, "ID\tNAME\tCREATED\tSTATE\tCONAINERNAME\tIMAGE\t")
+		fmt.Fprintln(w, "ID\tNAME\tCREATED\tSTATE\tCONAINERNAME\tIMAGE\tDISK\t")
 		for _, t := range tasks {
 			var start string
 			if t.StartTime.IsZero() {
@@ -66,13 +65,14 @@ The cube command allows a user to get the status of tasks from the Cube manager`
 
 			fmt.Fprintf(
 				w,
-				"%s\t%s\t%s\t%s\t%s\t%s\t\n",
+				"%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
 				t.ID,
 				t.Name,
 				start,
 				state,
-				t.Name,
+				t.ContainerName(),
 				t.Image,
+				units.HumanSize(float64(t.DiskUsage)),
 			)
 		}
 		w.Flush()
@@ -84,4 +84,5 @@ func init() {
 	rootCmd.AddCommand(statusCmd)
 
 	statusCmd.Flags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	statusCmd.Flags().StringP("namespace", "n", "default", "Namespace to work in")
 }
@@ -22,9 +22,9 @@ The stop command stops a running task.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("stop called")
 		manager, _ := cmd.Flags().GetString("manager")
-		url := fmt.Sprintf("http://%s/tasks/%s", manager, args[0])
+		url := fmt.Sprintf("%s://%s%s/tasks/%s", scheme(cmd), manager, namespacePath(cmd), args[0])
 
-		client := &http.Client{}
+		client := apiClient(cmd)
 
 		req, err := http.NewRequest("DELETE", url, nil)
 		if err != nil {
@@ -51,4 +51,5 @@ func init() {
 	rootCmd.AddCommand(stopCmd)
 
 	stopCmd.Flags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	stopCmd.Flags().StringP("namespace", "n", "default", "Namespace to work in")
 }
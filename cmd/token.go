@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/auth"
+	"github.com/spf13/cobra"
+)
+
+// tokenCmd represents the token command
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Token command to create API tokens.",
+	Long: `cube token command.
+
+The manager and the workers accept the static tokens of their --auth-config
+file and JWTs signed with its jwtSecret. Roles are viewer (read only),
+operator (create, change and delete resources) and admin (also manage
+namespaces and quotas).`,
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Sign a JWT with the secret of an auth config.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		authConfig, _ := cmd.Flags().GetString("auth-config")
+		role, _ := cmd.Flags().GetString("role")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		authenticator, err := auth.Load(authConfig)
+		if err != nil {
+			log.Fatalf("Unable to load auth config %s: %v\n", authConfig, err)
+		}
+		if authenticator.Secret == nil {
+			log.Fatalf("%s has no jwtSecret\n", authConfig)
+		}
+		token, err := auth.SignJWT(authenticator.Secret, auth.Identity{Name: args[0], Role: role}, ttl)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(token)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenCreateCmd)
+
+	tokenCreateCmd.Flags().String("auth-config", "auth.yaml", "Auth config with the jwtSecret to sign with")
+	tokenCreateCmd.Flags().String("role", auth.RoleViewer, "Role of the token, viewer, operator or admin")
+	tokenCreateCmd.Flags().Duration("ttl", 24*time.Hour, "How long the token is valid, 0 for ever")
+}
@@ -6,8 +6,10 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"net/http"
 
 	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/auth"
 	"github.com/jhonnyV-V/orch-in-go/worker"
 	"github.com/spf13/cobra"
 )
@@ -25,6 +27,11 @@ The worker runs tasks and responds to the manager's requests about tasks state`,
 		port, _ := cmd.Flags().GetInt("port")
 		name, _ := cmd.Flags().GetString("name")
 		dbtype, _ := cmd.Flags().GetString("dbtype")
+		authConfig, _ := cmd.Flags().GetString("auth-config")
+		join, _ := cmd.Flags().GetString("join")
+		managerAddress, _ := cmd.Flags().GetString("manager")
+		advertise, _ := cmd.Flags().GetString("advertise")
+		labels, _ := cmd.Flags().GetStringToString("labels")
 
 		log.Printf("starting worker\n")
 
@@ -34,10 +41,56 @@ The worker runs tasks and responds to the manager's requests about tasks state`,
 			Port:    port,
 			Worker:  w,
 		}
+		if authConfig != "" {
+			authenticator, err := auth.Load(authConfig)
+			if err != nil {
+				log.Fatalf("Unable to load auth config %s: %v\n", authConfig, err)
+			}
+			api.Auth = authenticator
+		}
+		proto := "http"
+		ca, cert, key := tlsFlags(cmd)
+		if ca != "" {
+			proto = "https"
+			// only the manager can send work to the workers
+			config, err := auth.ServerTLS(ca, cert, key, auth.CertManager)
+			if err != nil {
+				log.Fatalf("Unable to load TLS certificates: %v\n", err)
+			}
+			api.TLS = config
+		}
+		// a joined worker sends its heartbeats to the manager it joined
+		if join != "" {
+			managerAddress = join
+		}
+		if managerAddress != "" {
+			if advertise == "" {
+				address, err := worker.AdvertiseAddress(host, port, managerAddress)
+				if err != nil {
+					log.Fatal(err)
+				}
+				advertise = address
+			}
+			client := &http.Client{
+				Transport: &auth.Transport{Base: clientTransport(ca, cert, key), Token: apiToken(cmd)},
+			}
+			managerURL := fmt.Sprintf("%s://%s", proto, managerAddress)
+			go func() {
+				registration := w.Registration(advertise, labels)
+				// joined from the side, the manager polls the API right away
+				if join != "" {
+					err := worker.Join(client, managerURL, registration)
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+				w.SendHeartbeats(client, managerURL, registration)
+			}()
+		}
 		go w.RunTasks()
 		go w.CollectStats()
 		go w.UpdateTasks()
-		log.Printf("starting worker %s API on http://%s:%d\n", name, host, port)
+		log.Printf("starting worker %s API on %s://%s:%d\n", name, proto, host, port)
 		api.Start()
 	},
 }
@@ -59,4 +112,13 @@ func init() {
 		"memory",
 		"Type of data store to use for tasks (\"memory\" or \"persistent\")",
 	)
+	workerCmd.Flags().String("join", "", "Manager (host:port) to register with, use --token for the join token")
+	workerCmd.Flags().String("manager", "", "Manager (host:port) listing this worker in its --workers, heartbeats are sent to it with --token and --advertise must match the listed address")
+	workerCmd.Flags().String("advertise", "", "Address (host:port) the manager reaches this worker at, defaults to --host:--port or, when --host is 0.0.0.0, to the address of the interface the manager is reached through")
+	workerCmd.Flags().StringToString("labels", nil, "Labels of the worker, as key=value pairs")
+	workerCmd.Flags().String(
+		"auth-config",
+		"",
+		"YAML file with the API tokens and JWT secret, the API is open without it",
+	)
 }
@@ -0,0 +1,76 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/spf13/cobra"
+)
+
+// workflowCmd represents the workflow command
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "Workflow command to list workflows.",
+	Long: `cube workflow command.
+
+The workflow command lists the workflows known by the manager with their
+tasks and what each of them depends on.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		url := fmt.Sprintf("%s://%s%s/workflows", scheme(cmd), managerAddr, namespacePath(cmd))
+		resp, err := apiClient(cmd).Get(url)
+		if err != nil {
+			log.Fatalf("Failed to get workflows from %s %v\n", url, err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var workflows []*manager.Workflow
+		err = json.Unmarshal(body, &workflows)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tTASK\tDEPENDS ON\tTASK ID\t")
+		for _, wf := range workflows {
+			for i, wt := range wf.Tasks {
+				id, name, status := "", "", ""
+				if i == 0 {
+					id, name, status = wf.ID.String(), wf.Name, wf.Status
+				}
+				fmt.Fprintf(
+					w,
+					"%s\t%s\t%s\t%s\t%s\t%s\t\n",
+					id,
+					name,
+					status,
+					wt.Name,
+					strings.Join(wt.DependsOn, ","),
+					wt.TaskID,
+				)
+			}
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(workflowCmd)
+
+	workflowCmd.Flags().StringP("manager", "m", "0.0.0.0:8099", "Manager to talk to")
+	workflowCmd.Flags().StringP("namespace", "n", "default", "Namespace to work in")
+}
@@ -0,0 +1,209 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/jhonnyV-V/orch-in-go/node"
+	"github.com/jhonnyV-V/orch-in-go/task"
+	"github.com/jhonnyV-V/orch-in-go/worker"
+)
+
+// ManagerHost is the address the workers of a cluster reach the manager
+// API at.
+const ManagerHost = "manager"
+
+// Cluster is a manager and a set of workers living in the same process.
+// Workers run on fake runtimes and every request the manager makes,
+// health checks included, is served in memory, so no docker daemon or
+// network is needed.
+type Cluster struct {
+	Manager  *manager.Manager
+	Workers  map[string]*worker.Worker
+	Runtimes map[string]*Runtime
+	handlers map[string]http.Handler
+	// servers serve the upgraded requests, a recorder can't be hijacked
+	servers    map[string]*httptest.Server
+	down       map[string]bool
+	ManagerApi *manager.Api
+}
+
+func NewCluster(workers int) *Cluster {
+	c := &Cluster{
+		Workers:  make(map[string]*worker.Worker),
+		Runtimes: make(map[string]*Runtime),
+		handlers: make(map[string]http.Handler),
+		servers:  make(map[string]*httptest.Server),
+		down:     make(map[string]bool),
+	}
+
+	var names []string
+	for i := 1; i <= workers; i++ {
+		name := fmt.Sprintf("worker-%d", i)
+		w := worker.New(name, "memory")
+		r := NewRuntime()
+		w.Runtime = r
+		api := &worker.Api{Worker: w}
+
+		c.Workers[name] = w
+		c.Runtimes[name] = r
+		c.handlers[name] = api.Handler()
+		names = append(names, name)
+	}
+
+	c.Manager = manager.New(names, "roundrobin", "memory")
+	c.Manager.Client = &http.Client{Transport: c}
+	c.ManagerApi = &manager.Api{Manager: c.Manager}
+	c.handlers[ManagerHost] = c.ManagerApi.Handler()
+
+	return c
+}
+
+// Submit queues t on the manager the same way POST /tasks would, going
+// through validation, admission webhooks and quotas.
+func (c *Cluster) Submit(t task.Task) (task.TaskEvent, error) {
+	te := task.TaskEvent{State: task.RUNNING, Task: t}
+	if errs := c.Manager.PrepareTaskEvent(&te); len(errs) > 0 {
+		return te, errs
+	}
+	return c.Manager.SubmitTask(te)
+}
+
+// Step runs one round of the whole cluster: the manager hands out work
+// and collects what the workers reported so far, then the workers run
+// whatever they were sent and send their heartbeats.
+func (c *Cluster) Step() {
+	c.Manager.Step()
+	for name, w := range c.Workers {
+		if !c.down[name] {
+			w.Step()
+		}
+	}
+	c.Heartbeats()
+}
+
+// Heartbeats has every running worker send a heartbeat to the manager,
+// like the workers listed with --workers do.
+func (c *Cluster) Heartbeats() {
+	client := &http.Client{Transport: c}
+	for name, w := range c.Workers {
+		if c.down[name] {
+			continue
+		}
+		r := node.Registration{Name: name, Address: name}
+		err := w.SendHeartbeat(client, "http://"+ManagerHost, r)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// StopWorker simulates the death of a worker: it stops processing work
+// and every request sent to it fails as if the host was unreachable.
+func (c *Cluster) StopWorker(name string) {
+	c.down[name] = true
+}
+
+// StartWorker brings a stopped worker back with the state it had.
+func (c *Cluster) StartWorker(name string) {
+	delete(c.down, name)
+}
+
+// Run steps the cluster until done returns true or the given number of
+// steps is exhausted, and reports whether done was reached.
+func (c *Cluster) Run(steps int, done func() bool) bool {
+	for i := 0; i < steps; i++ {
+		if done() {
+			return true
+		}
+		c.Step()
+	}
+	return done()
+}
+
+// Task returns the manager's view of a task.
+func (c *Cluster) Task(id uuid.UUID) *task.Task {
+	result, err := c.Manager.TaskDb.Get(id)
+	if err != nil {
+		return nil
+	}
+	return result.(*task.Task)
+}
+
+// WorkerOf returns the name of the worker the manager placed a task on.
+func (c *Cluster) WorkerOf(id uuid.UUID) string {
+	return c.Manager.TaskWorkerMap[id]
+}
+
+// RoundTrip routes requests for a worker to its API and requests for a
+// worker host on a published port to the fake container behind it.
+func (c *Cluster) RoundTrip(req *http.Request) (*http.Response, error) {
+	host, port, err := net.SplitHostPort(req.URL.Host)
+	if err != nil {
+		host = req.URL.Host
+	}
+	if c.down[host] {
+		return nil, fmt.Errorf("dial tcp %s: connect: no route to host", req.URL.Host)
+	}
+
+	if h, ok := c.handlers[req.URL.Host]; ok && req.Header.Get("Upgrade") != "" {
+		return c.upgrade(h, req)
+	}
+	if h, ok := c.handlers[req.URL.Host]; ok {
+		// requests proxied by the manager API carry its chi routing
+		// context, which would confuse the worker router
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(ctx))
+		return rec.Result(), nil
+	}
+
+	r, ok := c.Runtimes[host]
+	if !ok {
+		return nil, fmt.Errorf("unknown host %s", host)
+	}
+	found, healthy := r.healthy(port)
+	if !found {
+		return nil, fmt.Errorf("connection refused: %s", req.URL.Host)
+	}
+
+	rec := httptest.NewRecorder()
+	if healthy {
+		rec.WriteHeader(http.StatusOK)
+	} else {
+		rec.WriteHeader(http.StatusInternalServerError)
+	}
+	return rec.Result(), nil
+}
+
+// upgrade sends a request asking for a protocol upgrade, like exec, to a
+// real server for the handler.
+func (c *Cluster) upgrade(h http.Handler, req *http.Request) (*http.Response, error) {
+	s, ok := c.servers[req.URL.Host]
+	if !ok {
+		s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), chi.RouteCtxKey, nil)
+			h.ServeHTTP(w, r.WithContext(ctx))
+		}))
+		c.servers[req.URL.Host] = s
+	}
+	out := req.Clone(req.Context())
+	out.URL.Host = s.Listener.Addr().String()
+	out.Host = ""
+	out.RequestURI = ""
+	return http.DefaultTransport.RoundTrip(out)
+}
+
+// Close shuts down the servers started for upgraded requests.
+func (c *Cluster) Close() {
+	for _, s := range c.servers {
+		s.Close()
+	}
+}
@@ -0,0 +1,86 @@
+package fake_test
+
+import (
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/node"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+func TestClusterRunsSubmittedTasks(t *testing.T) {
+	c := fake.NewCluster(2)
+	te, err := c.Submit(task.Task{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := te.Task.ID
+	if got := c.Task(id); got == nil || got.State != task.PENDING {
+		t.Fatalf("submitted task is %v, expected it pending", got)
+	}
+
+	ok := c.Run(5, func() bool { return c.Task(id).State == task.RUNNING })
+	if !ok {
+		t.Fatalf("task is %v, expected it running", c.Task(id).State)
+	}
+	w := c.WorkerOf(id)
+	if _, ok := c.Workers[w]; !ok {
+		t.Fatalf("task placed on unknown worker %q", w)
+	}
+	if c.Task(id).ContainerID == "" {
+		t.Fatal("running task has no container")
+	}
+}
+
+func TestClusterReportsContainerCrashes(t *testing.T) {
+	c := fake.NewCluster(1)
+	te, err := c.Submit(task.Task{Name: "job", Image: "job", Kind: task.KindJob, RestartPolicy: task.RestartNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := te.Task.ID
+	if !c.Run(5, func() bool { return c.Task(id).State == task.RUNNING }) {
+		t.Fatalf("task is %v, expected it running", c.Task(id).State)
+	}
+
+	if err := c.Runtimes["worker-1"].Crash(c.Task(id).ContainerID); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Run(5, func() bool { return c.Task(id).State == task.FAILED }) {
+		t.Fatalf("task is %v after its container crashed, expected it failed", c.Task(id).State)
+	}
+}
+
+func TestClusterStoppedWorkersAreUnreachable(t *testing.T) {
+	c := fake.NewCluster(1)
+	te, err := c.Submit(task.Task{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := te.Task.ID
+	c.Run(5, func() bool { return c.Task(id).State == task.RUNNING })
+
+	c.StopWorker("worker-1")
+	c.Step()
+	if s := nodeStatus(c, "worker-1"); s != node.NotReady {
+		t.Fatalf("stopped worker is %s, expected it not ready", s)
+	}
+
+	c.StartWorker("worker-1")
+	c.Step()
+	if s := nodeStatus(c, "worker-1"); s != node.Ready {
+		t.Fatalf("worker is %s once started again, expected it ready", s)
+	}
+	if s := c.Task(id).State; s != task.RUNNING {
+		t.Fatalf("task is %v once its worker is back, expected it running", s)
+	}
+}
+
+func nodeStatus(c *fake.Cluster, name string) string {
+	for _, n := range c.Manager.WorkerNodes {
+		if n.Name == name {
+			return n.Status
+		}
+	}
+	return ""
+}
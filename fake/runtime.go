@@ -0,0 +1,326 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+const firstHostPort = 30000
+
+// Behavior describes how a fake container started from a given image acts.
+// The zero value is a container that pulls, starts and runs forever.
+type Behavior struct {
+	PullError  error
+	StartError error
+	// ExitAfter makes the container exit with ExitCode once it has been
+	// running for that long. Zero means it never exits on its own.
+	ExitAfter time.Duration
+	ExitCode  int
+	Unhealthy bool
+	Logs      string
+	// DiskUsage is reported as the size of the container writable layer.
+	DiskUsage int64
+	// Exec handles commands run inside the container. When nil every
+	// command exits with 0 without output.
+	Exec func(cmd []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+type Container struct {
+	ID         string
+	Config     task.Config
+	Behavior   Behavior
+	Status     string
+	ExitCode   int
+	StartTime  time.Time
+	FinishTime time.Time
+	HostPorts  nat.PortMap
+	OOMKilled  bool
+	Removed    bool
+}
+
+// Runtime is an in-memory task.Runtime. Nothing is pulled or executed,
+// containers only exist as entries in a map whose state is driven by the
+// configured behaviors and by calls to Exit and Crash.
+type Runtime struct {
+	mu         sync.Mutex
+	scripts    map[string][]Behavior
+	containers map[string]*Container
+	nextPort   int
+	Pulls      []string
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{
+		scripts:    make(map[string][]Behavior),
+		containers: make(map[string]*Container),
+		nextPort:   firstHostPort,
+	}
+}
+
+// SetBehavior scripts the containers started from image. Each call to Run
+// consumes the next behavior in order, the last one is reused once the
+// script runs out.
+func (r *Runtime) SetBehavior(image string, script ...Behavior) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scripts[image] = script
+}
+
+func (r *Runtime) nextBehavior(image string) Behavior {
+	script := r.scripts[image]
+	if len(script) == 0 {
+		return Behavior{}
+	}
+	b := script[0]
+	if len(script) > 1 {
+		r.scripts[image] = script[1:]
+	}
+	return b
+}
+
+func (r *Runtime) Run(c task.Config) task.RuntimeResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.nextBehavior(c.Image)
+	r.Pulls = append(r.Pulls, c.Image)
+	if b.PullError != nil {
+		return task.RuntimeResult{Error: b.PullError}
+	}
+	if b.StartError != nil {
+		return task.RuntimeResult{Error: b.StartError}
+	}
+
+	exposed, ports, err := task.NewPortBindings(c.ExposedPorts, c.PortBindings)
+	if err != nil {
+		return task.RuntimeResult{Error: err}
+	}
+	for p := range exposed {
+		if _, ok := ports[p]; ok {
+			continue
+		}
+		ports[p] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(r.nextPort)}}
+		r.nextPort++
+	}
+
+	id := strings.ReplaceAll(uuid.New().String(), "-", "")
+	r.containers[id] = &Container{
+		ID:        id,
+		Config:    c,
+		Behavior:  b,
+		Status:    task.StatusRunning,
+		StartTime: time.Now().UTC(),
+		HostPorts: ports,
+	}
+
+	return task.RuntimeResult{
+		ContainerId: id,
+		Action:      "start",
+		Result:      "success",
+	}
+}
+
+func (r *Runtime) Stop(id string) task.RuntimeResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.containers[id]
+	if !ok || c.Removed {
+		return task.RuntimeResult{Error: fmt.Errorf("no such container: %s", id)}
+	}
+	r.refresh(c)
+	if c.Status == task.StatusRunning {
+		c.finish(137)
+	}
+	c.Removed = true
+
+	return task.RuntimeResult{
+		ContainerId: id,
+		Action:      "stop",
+		Result:      "success",
+	}
+}
+
+func (r *Runtime) Inspect(id string) task.InspectResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.containers[id]
+	if !ok || c.Removed {
+		return task.InspectResult{Error: fmt.Errorf("no such container: %s", id)}
+	}
+	r.refresh(c)
+
+	status := &task.ContainerStatus{
+		ID:         c.ID,
+		Name:       c.Config.Name,
+		Image:      c.Config.Image,
+		Status:     c.Status,
+		OOMKilled:  c.OOMKilled,
+		ExitCode:   c.ExitCode,
+		StartedAt:  c.StartTime,
+		FinishedAt: c.FinishTime,
+		HostPorts:  c.HostPorts,
+	}
+	usage := c.Behavior.DiskUsage
+	status.DiskUsage = &usage
+
+	return task.InspectResult{Container: status}
+}
+
+func (r *Runtime) Logs(id string, opts task.LogsOptions) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.containers[id]
+	if !ok || c.Removed {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+	if opts.Since != "" {
+		return nil, task.ErrSinceUnsupported
+	}
+	return io.NopCloser(strings.NewReader(c.Behavior.Logs)), nil
+}
+
+func (r *Runtime) Exec(ctx context.Context, id string, opts task.ExecOptions, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	r.mu.Lock()
+	c, ok := r.containers[id]
+	if ok {
+		r.refresh(c)
+	}
+	r.mu.Unlock()
+
+	if !ok || c.Removed {
+		return -1, fmt.Errorf("no such container: %s", id)
+	}
+	if c.Status != task.StatusRunning {
+		return -1, fmt.Errorf("container %s is not running", id)
+	}
+	if c.Behavior.Exec == nil {
+		return 0, nil
+	}
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	return c.Behavior.Exec(opts.Cmd, stdin, stdout, stderr), nil
+}
+
+func (r *Runtime) List() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+	for id, c := range r.containers {
+		if !c.Removed {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Exit makes a running container exit with the given code, as if its
+// process had terminated on its own.
+func (r *Runtime) Exit(id string, code int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.containers[id]
+	if !ok || c.Removed {
+		return fmt.Errorf("no such container: %s", id)
+	}
+	if c.Status != task.StatusRunning {
+		return fmt.Errorf("container %s is not running", id)
+	}
+	c.finish(code)
+	return nil
+}
+
+// Crash kills a running container the way the OOM killer would.
+func (r *Runtime) Crash(id string) error {
+	err := r.Exit(id, 137)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.containers[id].OOMKilled = true
+	r.mu.Unlock()
+	return nil
+}
+
+// SetHealthy flips the result of the health check of a container.
+func (r *Runtime) SetHealthy(id string, healthy bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.containers[id]
+	if !ok {
+		return fmt.Errorf("no such container: %s", id)
+	}
+	c.Behavior.Unhealthy = !healthy
+	return nil
+}
+
+// Containers returns a snapshot of every container the runtime knows
+// about, removed ones included, ordered by start time.
+func (r *Runtime) Containers() []Container {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var containers []Container
+	for _, c := range r.containers {
+		r.refresh(c)
+		containers = append(containers, *c)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].StartTime.Before(containers[j].StartTime)
+	})
+	return containers
+}
+
+// healthy reports whether a running container listens on hostPort and
+// whether it answers its health check.
+func (r *Runtime) healthy(hostPort string) (found bool, healthy bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.containers {
+		r.refresh(c)
+		if c.Removed || c.Status != task.StatusRunning {
+			continue
+		}
+		for _, bindings := range c.HostPorts {
+			for _, b := range bindings {
+				if b.HostPort == hostPort {
+					return true, !c.Behavior.Unhealthy
+				}
+			}
+		}
+	}
+	return false, false
+}
+
+func (r *Runtime) refresh(c *Container) {
+	if c.Status != task.StatusRunning || c.Behavior.ExitAfter == 0 {
+		return
+	}
+	if time.Since(c.StartTime) >= c.Behavior.ExitAfter {
+		c.finish(c.Behavior.ExitCode)
+	}
+}
+
+func (c *Container) finish(code int) {
+	c.Status = task.StatusExited
+	c.ExitCode = code
+	c.FinishTime = time.Now().UTC()
+}
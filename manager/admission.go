@@ -0,0 +1,350 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+	"gopkg.in/yaml.v3"
+)
+
+// Types of admission webhooks. Mutating webhooks run first, in order, and
+// can change the task event, validating webhooks only get to accept or
+// reject the final version.
+const (
+	WebhookMutating   = "mutating"
+	WebhookValidating = "validating"
+)
+
+// What happens to a task when its webhook can't be called or answers
+// garbage.
+const (
+	FailurePolicyFail   = "Fail"
+	FailurePolicyIgnore = "Ignore"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+type Webhook struct {
+	Name          string
+	Type          string
+	URL           string
+	FailurePolicy string
+	Timeout       string
+}
+
+func (w *Webhook) Validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("webhook name is required")
+	}
+	if w.URL == "" {
+		return fmt.Errorf("webhook %s: url is required", w.Name)
+	}
+	switch w.Type {
+	case WebhookMutating, WebhookValidating:
+	default:
+		return fmt.Errorf("webhook %s: unknown type %q", w.Name, w.Type)
+	}
+	switch w.FailurePolicy {
+	case "", FailurePolicyFail, FailurePolicyIgnore:
+	default:
+		return fmt.Errorf("webhook %s: unknown failure policy %q", w.Name, w.FailurePolicy)
+	}
+	if w.Timeout != "" {
+		if _, err := time.ParseDuration(w.Timeout); err != nil {
+			return fmt.Errorf("webhook %s: invalid timeout: %v", w.Name, err)
+		}
+	}
+	return nil
+}
+
+func (w *Webhook) timeout() time.Duration {
+	d, err := time.ParseDuration(w.Timeout)
+	if err != nil || d <= 0 {
+		return defaultWebhookTimeout
+	}
+	return d
+}
+
+// LoadWebhooks reads the admission configuration, a YAML (or JSON) file
+// with a list of webhooks:
+//
+//	webhooks:
+//	  - name: registries
+//	    type: validating
+//	    url: http://policy.internal/validate
+//	    failurePolicy: Fail
+func LoadWebhooks(path string) ([]Webhook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	config := struct{ Webhooks []Webhook }{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range config.Webhooks {
+		err = w.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config.Webhooks, nil
+}
+
+// AdmissionReview is posted to the webhooks, UID identifies the request and
+// is sent back in the response.
+type AdmissionReview struct {
+	UID       uuid.UUID
+	TaskEvent task.TaskEvent
+}
+
+// AdmissionResponse is what a webhook answers. Patch is a JSON patch
+// (RFC 6902) applied to the TaskEvent of the review, it is only looked at
+// for mutating webhooks.
+type AdmissionResponse struct {
+	UID     uuid.UUID
+	Allowed bool
+	Message string
+	Patch   []PatchOperation
+}
+
+// AdmissionError is returned when a webhook rejects a task.
+type AdmissionError struct {
+	Webhook string
+	Message string
+}
+
+func (e *AdmissionError) Error() string {
+	return fmt.Sprintf("admission webhook %s denied the task: %s", e.Webhook, e.Message)
+}
+
+// SubmitTask runs a new task through the admission webhooks and the quota
+// of its namespace, and queues it.
+// The task is stored as PENDING right away, so its ID and name are taken
+// even before it is sent to a worker. It is called without the lock, the
+// webhooks are called without it, so the IDs and the name of the task are
+// checked again once it is taken back.
+func (m *Manager) SubmitTask(te task.TaskEvent) (task.TaskEvent, error) {
+	te, err := m.admit(te)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		if errs := m.taken(te); len(errs) > 0 {
+			err = errs
+		}
+	}
+	if err == nil {
+		err = m.checkNamespace(te.Task)
+	}
+	if err != nil {
+		log.Printf("task %s (%v) not admitted: %v\n", te.Task.Name, te.Task.ID, err)
+		return te, err
+	}
+	m.TaskDb.Put(te.Task.ID, &te.Task)
+	m.AddTask(te)
+	return te, nil
+}
+
+// submitTask is SubmitTask for the manager itself, the services, cron
+// tasks, workflows and manifests, which hold the lock. The quota is
+// checked right away, the webhooks are called once the lock is released
+// and a task they reject ends up FAILED.
+func (m *Manager) submitTask(te task.TaskEvent) error {
+	return m.replaceTask(te, uuid.Nil)
+}
+
+// replaceTask is submitTask for a task of a manifest taking the place of
+// task old, which is already marked Retired. Old is stopped once the new
+// task is admitted, and kept if it isn't.
+func (m *Manager) replaceTask(te task.TaskEvent, old uuid.UUID) error {
+	err := m.checkQuota(te.Task)
+	if err != nil {
+		log.Printf("task %s (%v) not admitted: %v\n", te.Task.Name, te.Task.ID, err)
+		return err
+	}
+	m.TaskDb.Put(te.Task.ID, &te.Task)
+	if len(m.Webhooks) == 0 {
+		m.admitted(te, old)
+		return nil
+	}
+	m.later(func() {
+		admitted, err := m.admit(te)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.finishAdmission(admitted, err, old)
+	})
+	return nil
+}
+
+// finishAdmission queues a task admitted by replaceTask, or fails it.
+func (m *Manager) finishAdmission(te task.TaskEvent, err error, old uuid.UUID) {
+	result, getErr := m.TaskDb.Get(te.Task.ID)
+	if getErr != nil || result.(*task.Task).State != task.PENDING {
+		// cancelled or forgotten while the webhooks were called, the
+		// task it replaces goes all the same
+		m.retire(old)
+		return
+	}
+	if err == nil {
+		err = m.checkNamespace(te.Task)
+	}
+	if err != nil {
+		log.Printf("task %s (%v) not admitted: %v\n", te.Task.Name, te.Task.ID, err)
+		t := result.(*task.Task)
+		t.State = task.FAILED
+		t.TerminationReason = task.ReasonRejected
+		t.FinishTime = time.Now().UTC()
+		m.TaskDb.Put(t.ID, t)
+		delete(m.Retired, old)
+		return
+	}
+	m.TaskDb.Put(te.Task.ID, &te.Task)
+	m.admitted(te, old)
+}
+
+// admitted queues an admitted task. The task it replaces is cancelled
+// first, so its container is stopped before the new one takes its name.
+func (m *Manager) admitted(te task.TaskEvent, old uuid.UUID) {
+	m.retire(old)
+	m.AddTask(te)
+}
+
+// checkNamespace makes sure the namespace of an admitted task still
+// exists and has room for it.
+func (m *Manager) checkNamespace(t task.Task) error {
+	if _, err := m.GetNamespace(namespaceOf(t.Namespace)); err != nil {
+		return err
+	}
+	return m.checkQuota(t)
+}
+
+func (m *Manager) admit(te task.TaskEvent) (task.TaskEvent, error) {
+	submitted := te
+	for _, w := range m.Webhooks {
+		if w.Type != WebhookMutating {
+			continue
+		}
+		mutated, err := m.callWebhook(w, te)
+		if err != nil {
+			return te, err
+		}
+		te = mutated
+	}
+
+	// a patch can break what was valid, take over the identity of another
+	// task or move it to a namespace whose quota wasn't checked
+	if errs := te.Task.Validate(); len(errs) > 0 {
+		return te, fmt.Errorf("task is invalid after mutation: %v", errs.Prefix("Task"))
+	}
+	if te.Task.ID != submitted.Task.ID || te.Task.Name != submitted.Task.Name || te.Task.Namespace != submitted.Task.Namespace {
+		return te, fmt.Errorf("mutating webhooks can't change the ID, the name or the namespace of a task")
+	}
+	if te.ID != submitted.ID || te.State != submitted.State || te.Task.State != submitted.Task.State {
+		return te, fmt.Errorf("mutating webhooks can't change the ID or the states of a task event")
+	}
+
+	for _, w := range m.Webhooks {
+		if w.Type != WebhookValidating {
+			continue
+		}
+		_, err := m.callWebhook(w, te)
+		if err != nil {
+			return te, err
+		}
+	}
+	return te, nil
+}
+
+// callWebhook sends te to a webhook and returns te with the patch of the
+// webhook applied. Webhooks that fail with the Ignore policy leave te as
+// it is.
+func (m *Manager) callWebhook(w Webhook, te task.TaskEvent) (task.TaskEvent, error) {
+	resp, err := m.reviewTask(w, te)
+	if err == nil && resp.Allowed && len(resp.Patch) > 0 && w.Type == WebhookMutating {
+		te, err = patchTaskEvent(te, resp.Patch)
+	}
+	if err != nil {
+		if w.FailurePolicy == FailurePolicyIgnore {
+			log.Printf("ignoring failure of admission webhook %s: %v\n", w.Name, err)
+			return te, nil
+		}
+		return te, fmt.Errorf("admission webhook %s failed: %v", w.Name, err)
+	}
+	if !resp.Allowed {
+		return te, &AdmissionError{Webhook: w.Name, Message: resp.Message}
+	}
+	return te, nil
+}
+
+func (m *Manager) reviewTask(w Webhook, te task.TaskEvent) (*AdmissionResponse, error) {
+	review := AdmissionReview{UID: uuid.New(), TaskEvent: te}
+	data, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", w.URL, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := *m.WebhookClient
+	client.Timeout = w.timeout()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	result := AdmissionResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	if result.UID != review.UID {
+		return nil, fmt.Errorf("response is for review %v, not %v", result.UID, review.UID)
+	}
+	return &result, nil
+}
+
+func patchTaskEvent(te task.TaskEvent, patch []PatchOperation) (task.TaskEvent, error) {
+	data, err := json.Marshal(te)
+	if err != nil {
+		return te, err
+	}
+	data, err = ApplyPatch(data, patch)
+	if err != nil {
+		return te, err
+	}
+
+	patched := task.TaskEvent{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&patched)
+	if err != nil {
+		return te, fmt.Errorf("patched task event: %v", err)
+	}
+	return patched, nil
+}
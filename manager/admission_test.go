@@ -0,0 +1,121 @@
+package manager_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// patchingWebhook answers every review with the given patch.
+func patchingWebhook(t *testing.T, patch []manager.PatchOperation) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		review := manager.AdmissionReview{}
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			t.Errorf("decoding review: %v", err)
+		}
+		json.NewEncoder(w).Encode(manager.AdmissionResponse{UID: review.UID, Allowed: true, Patch: patch})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestMutatingWebhooksPatchTasks(t *testing.T) {
+	c := fake.NewCluster(1)
+	s := patchingWebhook(t, []manager.PatchOperation{{Op: "add", Path: "/Task/Env/-", Value: "INJECTED=1"}})
+	c.Manager.Webhooks = []manager.Webhook{{Name: "env", Type: manager.WebhookMutating, URL: s.URL}}
+
+	te, err := c.Submit(task.Task{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env := c.Task(te.Task.ID).Env; len(env) != 1 || env[0] != "INJECTED=1" {
+		t.Fatalf("task has env %v, expected the webhook's", env)
+	}
+}
+
+func TestMutatingWebhooksCantMoveTasks(t *testing.T) {
+	c := fake.NewCluster(1)
+	_, err := c.Manager.AddNamespace(manager.Namespace{Name: "team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]manager.PatchOperation{
+		"namespace":  {{Op: "replace", Path: "/Task/Namespace", Value: "team"}},
+		"task state": {{Op: "replace", Path: "/Task/State", Value: task.RUNNING}},
+		"event id":   {{Op: "replace", Path: "/ID", Value: "00000000-0000-0000-0000-000000000001"}},
+	}
+	for name, patch := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := patchingWebhook(t, patch)
+			c.Manager.Webhooks = []manager.Webhook{{Name: "move", Type: manager.WebhookMutating, URL: s.URL}}
+
+			te, err := c.Submit(task.Task{Image: "nginx"})
+			if err == nil {
+				t.Fatalf("task admitted in namespace %s", c.Task(te.Task.ID).Namespace)
+			}
+			if c.Task(te.Task.ID) != nil {
+				t.Fatal("rejected task was stored")
+			}
+		})
+	}
+}
+
+func TestWebhooksRejectTasksOfServices(t *testing.T) {
+	c := fake.NewCluster(1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		review := manager.AdmissionReview{}
+		json.NewDecoder(r.Body).Decode(&review)
+		json.NewEncoder(w).Encode(manager.AdmissionResponse{UID: review.UID, Message: "no"})
+	}))
+	defer s.Close()
+	c.Manager.Webhooks = []manager.Webhook{{Name: "deny", Type: manager.WebhookValidating, URL: s.URL}}
+
+	svc := addService(t, c, manager.Service{Name: "web", Replicas: 1, Template: web("web:1")})
+	c.Step()
+	svc, _ = c.Manager.GetService(svc.ID)
+	tasks := c.Manager.ServiceTasks(svc)
+	if len(tasks) == 0 {
+		t.Fatal("service started no task")
+	}
+	for _, st := range tasks {
+		if st.State != task.FAILED || st.TerminationReason != task.ReasonRejected {
+			t.Fatalf("task is %v (%s), expected it rejected", st.State, st.TerminationReason)
+		}
+	}
+	if n := running(c.Runtimes["worker-1"], "web:1"); n != 0 {
+		t.Fatalf("%d rejected tasks are running", n)
+	}
+}
+
+func TestSubmitTaskChecksTheNameAgain(t *testing.T) {
+	c := fake.NewCluster(1)
+	// both pass validation before either is stored, like two requests
+	// waiting on the webhooks
+	first := task.TaskEvent{State: task.RUNNING, Task: task.Task{Name: "web", Image: "nginx"}}
+	second := first
+	if errs := c.Manager.PrepareTaskEvent(&first); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if errs := c.Manager.PrepareTaskEvent(&second); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if _, err := c.Manager.SubmitTask(first); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Manager.SubmitTask(second)
+	var taken task.FieldErrors
+	if !errors.As(err, &taken) {
+		t.Fatalf("second task named web was admitted: %v", err)
+	}
+	if c.Task(second.Task.ID) != nil {
+		t.Fatal("second task was stored")
+	}
+}
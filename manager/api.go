@@ -1,10 +1,18 @@
 package manager
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jhonnyV-V/orch-in-go/auth"
+	"github.com/jhonnyV-V/orch-in-go/task"
 )
 
 type Api struct {
@@ -12,6 +20,10 @@ type Api struct {
 	Port    int
 	Manager *Manager
 	Router  *chi.Mux
+	// Auth checks the token of every request, nil lets anyone in
+	Auth *auth.Authenticator
+	// TLS makes the API serve https, nil serves plain http
+	TLS *tls.Config
 }
 
 type ErrResponse struct {
@@ -19,21 +31,149 @@ type ErrResponse struct {
 	Message        string
 }
 
+// ValidationErrResponse is an ErrResponse listing every invalid field of
+// the body of a request.
+type ValidationErrResponse struct {
+	HTTPStatusCode int
+	Message        string
+	Errors         task.FieldErrors
+}
+
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
-	a.Router.Route("/tasks", func(r chi.Router) {
+	// workers join with a join token, not an API token, so registering
+	// and heartbeats check their own token
+	a.Router.Post("/nodes/register", a.RegisterNodeHandler)
+	a.Router.Post("/nodes/heartbeat", a.HeartbeatHandler)
+	a.Router.Group(func(r chi.Router) {
+		r.Use(a.Auth.Middleware)
+		r.Use(a.lockManager)
+		// the routes at the root work on the default namespace
+		a.namespacedRoutes(r)
+		r.Get("/nodes", a.GetNodesHandler)
+		r.Route("/namespaces", func(r chi.Router) {
+			r.With(auth.Require(auth.RoleAdmin)).Post("/", a.CreateNamespaceHandler)
+			r.Get("/", a.GetNamespacesHandler)
+			r.Route("/{namespace}", func(r chi.Router) {
+				r.Use(a.namespaceExists)
+				r.Get("/", a.GetNamespaceHandler)
+				r.With(auth.Require(auth.RoleAdmin)).Delete("/", a.DeleteNamespaceHandler)
+				a.namespacedRoutes(r)
+			})
+		})
+	})
+}
+
+func (a *Api) namespacedRoutes(router chi.Router) {
+	router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+			r.Post("/exec", a.ExecTaskHandler)
+		})
+	})
+	router.Route("/crontasks", func(r chi.Router) {
+		r.Post("/", a.PutCronTaskHandler)
+		r.Get("/", a.GetCronTasksHandler)
+		r.Route("/{cronTaskID}", func(r chi.Router) {
+			r.Get("/", a.GetCronTaskHandler)
+			r.Delete("/", a.DeleteCronTaskHandler)
+			r.Get("/runs", a.GetCronTaskRunsHandler)
 		})
 	})
-	a.Router.Route("/nodes", func(r chi.Router) {
-		r.Get("/", a.GetNodesHandler)
+	router.Route("/services", func(r chi.Router) {
+		r.Post("/", a.CreateServiceHandler)
+		r.Get("/", a.GetServicesHandler)
+		r.Route("/{serviceID}", func(r chi.Router) {
+			r.Get("/", a.GetServiceHandler)
+			r.Put("/", a.UpdateServiceHandler)
+			r.Delete("/", a.DeleteServiceHandler)
+			r.Get("/tasks", a.GetServiceTasksHandler)
+			r.Post("/rollout/undo", a.UndoRolloutHandler)
+		})
+	})
+	router.Route("/quota", func(r chi.Router) {
+		r.Get("/", a.GetQuotaHandler)
+		r.With(auth.Require(auth.RoleAdmin)).Put("/", a.PutQuotaHandler)
+	})
+	router.Route("/manifests", func(r chi.Router) {
+		r.Post("/apply", a.ApplyHandler)
+		r.Post("/diff", a.DiffManifestsHandler)
+		r.Post("/delete", a.DeleteManifestsHandler)
 	})
+	router.Route("/workflows", func(r chi.Router) {
+		r.Post("/", a.StartWorkflowHandler)
+		r.Get("/", a.GetWorkflowsHandler)
+		r.Route("/{workflowID}", func(r chi.Router) {
+			r.Get("/", a.GetWorkflowHandler)
+			r.Delete("/", a.DeleteWorkflowHandler)
+			r.Get("/tasks", a.GetWorkflowTasksHandler)
+		})
+	})
+}
 
+func (a *Api) Handler() http.Handler {
+	if a.Router == nil {
+		a.initRouter()
+	}
+	return a.Router
 }
+
 func (a *Api) Start() {
 	a.initRouter()
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	addr := fmt.Sprintf("%s:%d", a.Address, a.Port)
+	if a.TLS == nil {
+		http.ListenAndServe(addr, a.Router)
+		return
+	}
+	server := &http.Server{Addr: addr, Handler: a.Router, TLSConfig: a.TLS}
+	server.ListenAndServeTLS("", "")
+}
+
+type unlockKey struct{}
+
+// maxBodySize caps the bodies of requests, they are read before taking
+// the manager lock so a slow client can't hold it.
+const maxBodySize = 8 << 20
+
+// lockManager holds the manager lock while a request is handled, reading
+// requests share it. Handlers streaming for a long time give it back
+// early with unlockManager.
+func (a *Api) lockManager(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: fmt.Sprintf("Error reading body: %v", err)})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		unlock := a.Manager.mu.Unlock
+		if auth.ReadOnly(r) {
+			a.Manager.mu.RLock()
+			unlock = a.Manager.mu.RUnlock
+		} else {
+			a.Manager.mu.Lock()
+		}
+		// the calls to workers and webhooks queued by the handler are
+		// made once the lock is given back
+		var once sync.Once
+		release := func() {
+			once.Do(func() {
+				unlock()
+				a.Manager.flush()
+			})
+		}
+		defer release()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), unlockKey{}, release)))
+	})
+}
+
+func unlockManager(r *http.Request) {
+	if release, ok := r.Context().Value(unlockKey{}).(func()); ok {
+		release()
+	}
 }
@@ -0,0 +1,257 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+	"github.com/robfig/cron/v3"
+)
+
+// Concurrency policies of a cron task, they decide what happens when a
+// run is due while the previous one is still active.
+const (
+	ConcurrencyAllow   = "Allow"
+	ConcurrencyForbid  = "Forbid"
+	ConcurrencyReplace = "Replace"
+)
+
+const defaultCronHistoryLimit = 3
+
+// CronTask starts a new task from Template every time Schedule, a standard
+// five field cron expression or a descriptor like @daily, fires.
+type CronTask struct {
+	ID                         uuid.UUID
+	Name                       string
+	Namespace                  string
+	Schedule                   string
+	Template                   task.Task
+	ConcurrencyPolicy          string
+	SuccessfulRunsHistoryLimit int
+	FailedRunsHistoryLimit     int
+	Suspend                    bool
+	LastScheduleTime           time.Time
+	NextScheduleTime           time.Time
+	Runs                       []uuid.UUID
+}
+
+func (c *CronTask) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("cron task name is required")
+	}
+	if errs := c.Template.Validate(); len(errs) > 0 {
+		return errs.Prefix("Template")
+	}
+	_, err := cron.ParseStandard(c.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %v", c.Schedule, err)
+	}
+	switch c.ConcurrencyPolicy {
+	case ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		return fmt.Errorf("unknown concurrency policy %q", c.ConcurrencyPolicy)
+	}
+	if c.SuccessfulRunsHistoryLimit < 0 || c.FailedRunsHistoryLimit < 0 {
+		return fmt.Errorf("history limits can't be negative")
+	}
+	return nil
+}
+
+func (c *CronTask) setDefaults() {
+	if c.ConcurrencyPolicy == "" {
+		c.ConcurrencyPolicy = ConcurrencyAllow
+	}
+	if c.SuccessfulRunsHistoryLimit == 0 {
+		c.SuccessfulRunsHistoryLimit = defaultCronHistoryLimit
+	}
+	if c.FailedRunsHistoryLimit == 0 {
+		c.FailedRunsHistoryLimit = defaultCronHistoryLimit
+	}
+	if c.Template.Kind == "" {
+		c.Template.Kind = task.KindJob
+	}
+}
+
+// AddCronTask stores a new cron task, or replaces the spec of the one with
+// the same ID, and computes when it runs next.
+func (m *Manager) AddCronTask(c CronTask) (*CronTask, error) {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	c.setDefaults()
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	c.Namespace = namespaceOf(c.Namespace)
+	if _, err := m.GetNamespace(c.Namespace); err != nil {
+		return nil, err
+	}
+	if other, ok := m.cronTaskByName(c.Namespace, c.Name); ok && other.ID != c.ID {
+		return nil, fmt.Errorf("cron task %s already exists in namespace %s", c.Name, c.Namespace)
+	}
+
+	existing, err := m.CronDb.Get(c.ID)
+	if err == nil && namespaceOf(existing.(*CronTask).Namespace) != c.Namespace {
+		return nil, fmt.Errorf("cron task %v belongs to another namespace", c.ID)
+	}
+	if err == nil {
+		c.Runs = existing.(*CronTask).Runs
+		c.LastScheduleTime = existing.(*CronTask).LastScheduleTime
+	}
+
+	schedule, _ := cron.ParseStandard(c.Schedule)
+	c.NextScheduleTime = schedule.Next(time.Now())
+
+	err = m.CronDb.Put(c.ID, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (m *Manager) GetCronTasks() []*CronTask {
+	results, err := m.CronDb.List()
+	if err != nil {
+		log.Printf("error getting list of cron tasks: %v\n", err)
+		return nil
+	}
+	return results.([]*CronTask)
+}
+
+func (m *Manager) GetCronTask(id uuid.UUID) (*CronTask, error) {
+	result, err := m.CronDb.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*CronTask), nil
+}
+
+// CronTaskRuns returns the tasks started by a cron task still kept in its
+// history, oldest first.
+func (m *Manager) CronTaskRuns(c *CronTask) []*task.Task {
+	runs := []*task.Task{}
+	for _, id := range c.Runs {
+		result, err := m.TaskDb.Get(id)
+		if err != nil {
+			// still waiting in the pending queue
+			runs = append(runs, &task.Task{ID: id, Name: c.Name, State: task.PENDING})
+			continue
+		}
+		runs = append(runs, result.(*task.Task))
+	}
+	return runs
+}
+
+func (m *Manager) DeleteCronTask(id uuid.UUID) error {
+	_, err := m.CronDb.Get(id)
+	if err != nil {
+		return err
+	}
+	return m.CronDb.Delete(id)
+}
+
+func (m *Manager) ProcessCronTasks() {
+	for {
+		log.Println("Checking cron tasks")
+		m.mu.Lock()
+		m.runCronTasks(time.Now())
+		m.mu.Unlock()
+		m.flush()
+		time.Sleep(10 * time.Second)
+	}
+}
+
+func (m *Manager) runCronTasks(now time.Time) {
+	for _, c := range m.GetCronTasks() {
+		if c.Suspend || now.Before(c.NextScheduleTime) {
+			continue
+		}
+
+		schedule, err := cron.ParseStandard(c.Schedule)
+		if err != nil {
+			log.Printf("invalid schedule for cron task %s: %v\n", c.Name, err)
+			continue
+		}
+		c.LastScheduleTime = now
+		c.NextScheduleTime = schedule.Next(now)
+
+		active := m.activeCronRuns(c)
+		switch {
+		case len(active) > 0 && c.ConcurrencyPolicy == ConcurrencyForbid:
+			log.Printf("skipping run of cron task %s, previous run still active\n", c.Name)
+		case len(active) > 0 && c.ConcurrencyPolicy == ConcurrencyReplace:
+			for _, t := range active {
+				m.cancelTask(t)
+			}
+			m.startCronRun(c, now)
+		default:
+			m.startCronRun(c, now)
+		}
+
+		m.pruneCronRuns(c)
+		m.CronDb.Put(c.ID, c)
+	}
+}
+
+func (m *Manager) startCronRun(c *CronTask, now time.Time) {
+	t := c.Template
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%d", c.Name, now.Unix())
+	t.Namespace = namespaceOf(c.Namespace)
+	t.State = task.PENDING
+	t.RestartCount = 0
+
+	err := m.submitTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.RUNNING,
+		Timestamp: now,
+		Task:      t,
+	})
+	if err != nil {
+		return
+	}
+	c.Runs = append(c.Runs, t.ID)
+	log.Printf("cron task %s started run %s\n", c.Name, t.ID)
+}
+
+func (m *Manager) activeCronRuns(c *CronTask) []*task.Task {
+	var active []*task.Task
+	for _, t := range m.CronTaskRuns(c) {
+		if t.State == task.PENDING || t.State == task.SCHEDULED || t.State == task.RUNNING {
+			active = append(active, t)
+		}
+	}
+	return active
+}
+
+// pruneCronRuns forgets the oldest finished runs beyond the history
+// limits. Active runs are always kept.
+func (m *Manager) pruneCronRuns(c *CronTask) {
+	runs := m.CronTaskRuns(c)
+	succeeded, failed := 0, 0
+	keep := make([]uuid.UUID, len(runs))
+	kept := len(runs)
+	for i := len(runs) - 1; i >= 0; i-- {
+		t := runs[i]
+		switch t.State {
+		case task.COMPLETED:
+			succeeded++
+			if succeeded > c.SuccessfulRunsHistoryLimit {
+				continue
+			}
+		case task.FAILED, task.SKIPPED:
+			// a run replaced before it started didn't succeed either
+			failed++
+			if failed > c.FailedRunsHistoryLimit {
+				continue
+			}
+		}
+		kept--
+		keep[kept] = t.ID
+	}
+	c.Runs = keep[kept:]
+}
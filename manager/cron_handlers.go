@@ -0,0 +1,114 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (a *Api) PutCronTaskHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	cronTask := CronTask{}
+	err := decoder.Decode(&cronTask)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	if !setNamespace(w, r, &cronTask.Namespace) || !allowHostAccess(w, r, cronTask.Template) {
+		return
+	}
+
+	c, err := a.Manager.AddCronTask(cronTask)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid cron task: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	log.Printf("Added cron task %s (%v)\n", c.Name, c.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (a *Api) GetCronTasksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	cronTasks := []*CronTask{}
+	for _, c := range a.Manager.GetCronTasks() {
+		if inNamespace(r, c.Namespace) {
+			cronTasks = append(cronTasks, c)
+		}
+	}
+	json.NewEncoder(w).Encode(cronTasks)
+}
+
+func (a *Api) cronTask(w http.ResponseWriter, r *http.Request) (*CronTask, bool) {
+	cronTaskID := chi.URLParam(r, "cronTaskID")
+	id, err := uuid.Parse(cronTaskID)
+	if err != nil {
+		msg := fmt.Sprintf("invalid cron task id %s: %v", cronTaskID, err)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return nil, false
+	}
+
+	c, err := a.Manager.GetCronTask(id)
+	if err == nil && !inNamespace(r, c.Namespace) {
+		err = fmt.Errorf("cron task %v not found in namespace %s", id, namespace(r))
+	}
+	if err != nil {
+		log.Printf("No cron task with id %v found\n", id)
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return nil, false
+	}
+	return c, true
+}
+
+func (a *Api) GetCronTaskHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.cronTask(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (a *Api) GetCronTaskRunsHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.cronTask(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.CronTaskRuns(c))
+}
+
+func (a *Api) DeleteCronTaskHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.cronTask(w, r)
+	if !ok {
+		return
+	}
+	err := a.Manager.DeleteCronTask(c.ID)
+	if err != nil {
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: err.Error()})
+		return
+	}
+	log.Printf("Deleted cron task %s (%v)\n", c.Name, c.ID)
+	w.WriteHeader(204)
+}
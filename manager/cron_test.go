@@ -0,0 +1,126 @@
+package manager_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+func addCronTask(t *testing.T, c *fake.Cluster, policy string) *manager.CronTask {
+	t.Helper()
+	ct, err := c.Manager.AddCronTask(manager.CronTask{
+		Name:              "backup",
+		Schedule:          "@hourly",
+		ConcurrencyPolicy: policy,
+		Template:          task.Task{Image: "backup"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ct
+}
+
+func cronRuns(t *testing.T, c *fake.Cluster, ct *manager.CronTask) []*task.Task {
+	t.Helper()
+	ct, err := c.Manager.GetCronTask(ct.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Manager.CronTaskRuns(ct)
+}
+
+func TestCronTasksRunOnTheirSchedule(t *testing.T) {
+	c := fake.NewCluster(1)
+	ct := addCronTask(t, c, manager.ConcurrencyAllow)
+	next := ct.NextScheduleTime
+
+	c.Manager.RunCronTasks(next.Add(-time.Minute))
+	if runs := cronRuns(t, c, ct); len(runs) != 0 {
+		t.Fatalf("cron task ran %d times before its schedule", len(runs))
+	}
+
+	c.Manager.RunCronTasks(next)
+	if runs := cronRuns(t, c, ct); len(runs) != 1 {
+		t.Fatalf("cron task ran %d times on its schedule, expected once", len(runs))
+	}
+	ct, _ = c.Manager.GetCronTask(ct.ID)
+	if !ct.LastScheduleTime.Equal(next) || !ct.NextScheduleTime.Equal(next.Add(time.Hour)) {
+		t.Fatalf("cron task last ran at %v and runs next at %v", ct.LastScheduleTime, ct.NextScheduleTime)
+	}
+
+	c.Manager.RunCronTasks(next.Add(30 * time.Minute))
+	if runs := cronRuns(t, c, ct); len(runs) != 1 {
+		t.Fatalf("cron task ran %d times, expected it to wait for the next hour", len(runs))
+	}
+}
+
+func TestCronTasksForbidOverlappingRuns(t *testing.T) {
+	c := fake.NewCluster(1)
+	ct := addCronTask(t, c, manager.ConcurrencyForbid)
+	next := ct.NextScheduleTime
+
+	c.Manager.RunCronTasks(next)
+	c.Run(5, func() bool { return running(c.Runtimes["worker-1"], "backup") == 1 })
+	c.Manager.RunCronTasks(next.Add(time.Hour))
+	if runs := cronRuns(t, c, ct); len(runs) != 1 {
+		t.Fatalf("cron task has %d runs, expected the second one to be skipped", len(runs))
+	}
+	ct, _ = c.Manager.GetCronTask(ct.ID)
+	if !ct.NextScheduleTime.Equal(next.Add(2 * time.Hour)) {
+		t.Fatalf("cron task runs next at %v, expected the skipped run to count", ct.NextScheduleTime)
+	}
+}
+
+func TestCronTasksReplacePendingRuns(t *testing.T) {
+	c := fake.NewCluster(1)
+	ct := addCronTask(t, c, manager.ConcurrencyReplace)
+	next := ct.NextScheduleTime
+
+	c.Manager.RunCronTasks(next)
+	c.Manager.RunCronTasks(next.Add(time.Hour))
+	runs := cronRuns(t, c, ct)
+	if len(runs) != 2 || runs[0].State != task.SKIPPED {
+		t.Fatalf("cron task runs are %v, expected the first one skipped", runs)
+	}
+
+	second := runs[1].ID
+	if !c.Run(10, func() bool { return c.Task(second).State == task.RUNNING }) {
+		t.Fatalf("second run is %v, expected it running", c.Task(second).State)
+	}
+	c.Run(3, func() bool { return false })
+	if n := running(c.Runtimes["worker-1"], "backup"); n != 1 {
+		t.Fatalf("%d runs are running, expected only the last one", n)
+	}
+	if s := c.Task(runs[0].ID).State; s != task.SKIPPED {
+		t.Fatalf("replaced run is %v, expected it skipped", s)
+	}
+}
+
+func TestCronTasksReplaceScheduledRuns(t *testing.T) {
+	c := fake.NewCluster(1)
+	ct := addCronTask(t, c, manager.ConcurrencyReplace)
+	next := ct.NextScheduleTime
+
+	c.Manager.RunCronTasks(next)
+	first := cronRuns(t, c, ct)[0].ID
+	// sent to the worker, which didn't get to start it yet
+	c.Manager.Step()
+	if s := c.Task(first).State; s != task.SCHEDULED {
+		t.Fatalf("first run is %v, expected it scheduled", s)
+	}
+
+	c.Manager.RunCronTasks(next.Add(time.Hour))
+	second := cronRuns(t, c, ct)[1].ID
+	ok := c.Run(10, func() bool {
+		return c.Task(first).State == task.COMPLETED && c.Task(second).State == task.RUNNING
+	})
+	if !ok {
+		t.Fatalf("runs are %v and %v, expected the first one stopped and the second running", c.Task(first).State, c.Task(second).State)
+	}
+	if n := running(c.Runtimes["worker-1"], "backup"); n != 1 {
+		t.Fatalf("%d runs are running, expected only the last one", n)
+	}
+}
@@ -0,0 +1,19 @@
+package manager
+
+import "time"
+
+// RunCronTasks lets the tests fire cron tasks at a chosen time.
+func (m *Manager) RunCronTasks(now time.Time) {
+	m.runCronTasks(now)
+}
+
+// CheckNodes lets the tests look for silent nodes at a chosen time.
+func (m *Manager) CheckNodes(now time.Time) {
+	m.checkNodes(now)
+}
+
+// RefreshTasks lets the tests see the tasks workers report as failed
+// before the health checks restart them.
+func (m *Manager) RefreshTasks() {
+	m.updateTasks()
+}
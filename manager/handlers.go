@@ -1,15 +1,22 @@
 package manager
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/auth"
+	"github.com/jhonnyV-V/orch-in-go/node"
 	"github.com/jhonnyV-V/orch-in-go/task"
+	"github.com/jhonnyV-V/orch-in-go/utils"
 )
 
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -30,7 +37,40 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.Manager.AddTask(taskEvent)
+	if !setNamespace(w, r, &taskEvent.Task.Namespace) || !allowHostAccess(w, r, taskEvent.Task) {
+		return
+	}
+
+	errs := a.Manager.PrepareTaskEvent(&taskEvent)
+	if len(errs) > 0 {
+		msg := fmt.Sprintf("Invalid task event: %v", errs)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ValidationErrResponse{
+			HTTPStatusCode: 400,
+			Message:        msg,
+			Errors:         errs,
+		})
+		return
+	}
+
+	// the webhooks are called without the lock
+	unlockManager(r)
+	taskEvent, err = a.Manager.SubmitTask(taskEvent)
+	if err != nil {
+		status := 500
+		var denied *AdmissionError
+		var overQuota *QuotaError
+		var taken task.FieldErrors
+		if errors.As(err, &denied) || errors.As(err, &overQuota) {
+			status = 403
+		} else if errors.As(err, &taken) {
+			status = 409
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: status, Message: err.Error()})
+		return
+	}
 	log.Printf("Added task %v\n", taskEvent.Task.ID)
 	w.WriteHeader(201)
 	json.NewEncoder(w).Encode(taskEvent.Task)
@@ -39,24 +79,38 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 func (a *Api) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(a.Manager.GetTasks())
+	json.NewEncoder(w).Encode(a.Manager.NamespaceTasks(namespace(r)))
 }
 
-func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
+// task looks up the task of the request, tasks of other namespaces are
+// not found.
+func (a *Api) task(w http.ResponseWriter, r *http.Request) (*task.Task, bool) {
 	taskID := chi.URLParam(r, "taskID")
-	if taskID == "" {
-		log.Println("no task id")
+	tId, err := uuid.Parse(taskID)
+	if err != nil {
+		msg := fmt.Sprintf("invalid task id %s: %v", taskID, err)
+		log.Println(msg)
 		w.WriteHeader(400)
-		return
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return nil, false
 	}
 
-	//TODO: handle bad uuid
-	tId, _ := uuid.Parse(taskID)
-
-	taskToStop, err := a.Manager.TaskDb.Get(tId)
+	result, err := a.Manager.TaskDb.Get(tId)
+	if err == nil && !inNamespace(r, result.(*task.Task).Namespace) {
+		err = fmt.Errorf("task %v not found in namespace %s", tId, namespace(r))
+	}
 	if err != nil {
 		log.Printf("No task with id %v found\n", tId)
 		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return nil, false
+	}
+	return result.(*task.Task), true
+}
+
+func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskToStop, ok := a.task(w, r)
+	if !ok {
 		return
 	}
 
@@ -66,7 +120,7 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now(),
 	}
 
-	taskCopy := *(taskToStop.(*task.Task))
+	taskCopy := *taskToStop
 	taskCopy.State = task.COMPLETED
 	taskEvent.Task = taskCopy
 
@@ -80,3 +134,211 @@ func (a *Api) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 	json.NewEncoder(w).Encode(a.Manager.WorkerNodes)
 }
+
+// joinAllowed checks the token of the requests of workers. It has to be
+// one of the join tokens of the manager or an admin API token, clusters
+// without join tokens nor authentication let any worker in.
+func (a *Api) joinAllowed(w http.ResponseWriter, r *http.Request) bool {
+	token := auth.BearerToken(r)
+	allowed := a.Manager.ValidJoinToken(token)
+	if !allowed && a.Auth != nil {
+		id, err := a.Auth.Authenticate(token)
+		allowed = err == nil && auth.Allows(id.Role, auth.RoleAdmin)
+	}
+	if !allowed && a.Auth == nil && len(a.Manager.JoinTokens) == 0 {
+		allowed = true
+	}
+	if !allowed {
+		log.Printf("refusing %s from %s, invalid join token\n", r.URL.Path, r.RemoteAddr)
+		w.WriteHeader(401)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 401, Message: "invalid join token"})
+	}
+	return allowed
+}
+
+// RegisterNodeHandler adds a worker announcing itself.
+func (a *Api) RegisterNodeHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.joinAllowed(w, r) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	registration := node.Registration{}
+	err := decoder.Decode(&registration)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	n, err := a.Manager.RegisterNode(registration)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid registration: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(n)
+}
+
+func (a *Api) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.joinAllowed(w, r) {
+		return
+	}
+
+	heartbeat := node.Heartbeat{}
+	err := json.NewDecoder(r.Body).Decode(&heartbeat)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body %v", err)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	err = a.Manager.Heartbeat(heartbeat)
+	if err != nil {
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.task(w, r)
+	if !ok {
+		return
+	}
+	tId := t.ID
+
+	// the worker is streamed from without the lock
+	worker, err := a.Manager.TaskWorker(tId)
+	unlockManager(r)
+	var resp *http.Response
+	if err == nil {
+		resp, err = a.Manager.TaskLogs(r.Context(), worker, tId, r.URL.RawQuery)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Error getting logs for task %v: %v", tId, err)
+		log.Println(msg)
+		w.WriteHeader(502)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 502, Message: msg})
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	utils.StreamResponse(w, resp.Body)
+}
+
+// ExecTaskHandler forwards an exec session to the worker running the task
+// and pipes the upgraded connections together.
+func (a *Api) ExecTaskHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.task(w, r)
+	if !ok {
+		return
+	}
+	tId := t.ID
+
+	if r.Header.Get("Upgrade") != utils.ExecProtocol {
+		msg := fmt.Sprintf("exec requires an upgrade to %s", utils.ExecProtocol)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		msg := fmt.Sprintf("Error reading body: %v", err)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	worker, err := a.Manager.TaskWorker(tId)
+	unlockManager(r)
+	var resp *http.Response
+	if err == nil {
+		resp, err = a.Manager.ExecTask(ctx, worker, tId, body)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Error starting exec for task %v: %v", tId, err)
+		log.Println(msg)
+		w.WriteHeader(502)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 502, Message: msg})
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		msg := "worker connection can't be used for exec"
+		w.WriteHeader(502)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 502, Message: msg})
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		msg := fmt.Sprintf("unable to hijack connection: %v", err)
+		log.Println(msg)
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: msg})
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", utils.ExecProtocol)
+	rw.Flush()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, rw.Reader)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+	log.Printf("exec session for task %v finished\n", tId)
+}
+
+// allowHostAccess answers 403 when someone who isn't an admin asks for
+// tasks reaching into the worker hosts. It lets requests through when
+// authentication is off.
+func allowHostAccess(w http.ResponseWriter, r *http.Request, specs ...task.Task) bool {
+	id := auth.FromContext(r.Context())
+	if id == nil || auth.Allows(id.Role, auth.RoleAdmin) {
+		return true
+	}
+	for _, t := range specs {
+		if access := t.HostAccess(); len(access) > 0 {
+			msg := fmt.Sprintf("%s (%s) can't create tasks with %s, it needs the %s role", id.Name, id.Role, strings.Join(access, ", "), auth.RoleAdmin)
+			log.Println(msg)
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 403, Message: msg})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// startJob submits a job and steps the cluster until its container runs.
+func startJob(t *testing.T, c *fake.Cluster, policy string) uuid.UUID {
+	t.Helper()
+	te, err := c.Submit(task.Task{Name: "job", Image: "job", Kind: task.KindJob, RestartPolicy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := te.Task.ID
+	if !c.Run(5, func() bool { return c.Task(id).State == task.RUNNING }) {
+		t.Fatalf("job is %v, expected it running", c.Task(id).State)
+	}
+	return id
+}
+
+// exitJob makes the container of a job exit with code.
+func exitJob(t *testing.T, c *fake.Cluster, id uuid.UUID, code int) {
+	t.Helper()
+	if err := c.Runtimes[c.WorkerOf(id)].Exit(c.Task(id).ContainerID, code); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobsCompleteWhenTheyExitWithZero(t *testing.T) {
+	c := fake.NewCluster(1)
+	id := startJob(t, c, task.RestartNever)
+
+	exitJob(t, c, id, 0)
+	if !c.Run(5, func() bool { return c.Task(id).State == task.COMPLETED }) {
+		t.Fatalf("job is %v, expected it completed", c.Task(id).State)
+	}
+	if r := c.Task(id).TerminationReason; r != task.ReasonCompleted {
+		t.Fatalf("termination reason is %q, expected %q", r, task.ReasonCompleted)
+	}
+}
+
+func TestJobsFailWithTheirExitCode(t *testing.T) {
+	c := fake.NewCluster(1)
+	id := startJob(t, c, task.RestartNever)
+
+	exitJob(t, c, id, 3)
+	if !c.Run(5, func() bool { return c.Task(id).State == task.FAILED }) {
+		t.Fatalf("job is %v, expected it failed", c.Task(id).State)
+	}
+	got := c.Task(id)
+	if got.ExitCode != 3 || got.TerminationReason != task.ReasonError {
+		t.Fatalf("job failed with code %d (%q), expected 3 (%q)", got.ExitCode, got.TerminationReason, task.ReasonError)
+	}
+
+	// never means never
+	c.Run(5, func() bool { return false })
+	if got := c.Task(id); got.State != task.FAILED || got.RestartCount != 0 {
+		t.Fatalf("job is %v after %d restarts, expected it left failed", got.State, got.RestartCount)
+	}
+}
+
+func TestJobsRestartOnFailure(t *testing.T) {
+	c := fake.NewCluster(1)
+	id := startJob(t, c, task.RestartOnFailure)
+
+	exitJob(t, c, id, 1)
+	ok := c.Run(10, func() bool {
+		got := c.Task(id)
+		return got.State == task.RUNNING && got.RestartCount == 1
+	})
+	if !ok {
+		got := c.Task(id)
+		t.Fatalf("job is %v after %d restarts, expected it running again", got.State, got.RestartCount)
+	}
+
+	exitJob(t, c, id, 0)
+	if !c.Run(5, func() bool { return c.Task(id).State == task.COMPLETED }) {
+		t.Fatalf("job is %v, expected it completed on its second run", c.Task(id).State)
+	}
+}
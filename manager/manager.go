@@ -2,11 +2,13 @@ package manager
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/go-connections/nat"
@@ -16,6 +18,7 @@ import (
 	"github.com/jhonnyV-V/orch-in-go/scheduler"
 	"github.com/jhonnyV-V/orch-in-go/storage"
 	"github.com/jhonnyV-V/orch-in-go/task"
+	"github.com/jhonnyV-V/orch-in-go/utils"
 	"github.com/jhonnyV-V/orch-in-go/worker"
 )
 
@@ -23,12 +26,57 @@ type Manager struct {
 	Pending       queue.Queue
 	TaskDb        storage.Storage
 	EventDb       storage.Storage
+	CronDb        storage.Storage
+	WorkflowDb    storage.Storage
 	Workers       []string
 	WorkerTaskMap map[string][]uuid.UUID
 	TaskWorkerMap map[uuid.UUID]string
 	LastWorker    int
 	WorkerNodes   []*node.Node
 	Scheduler     scheduler.Scheduler
+	Client        *http.Client
+	ServiceDb     storage.Storage
+	NamespaceDb   storage.Storage
+	Health        map[uuid.UUID]*HealthRecord
+	// Webhooks are called, in order, before a new task is queued
+	Webhooks []Webhook
+	// WebhookClient calls the webhooks. It is not Client, which is set up
+	// for the workers and their CA.
+	WebhookClient *http.Client
+	// Scheme of the worker APIs, http unless UseTLS was called
+	Scheme string
+	// JoinTokens let workers register themselves with POST /nodes/register
+	JoinTokens []string
+	// RescheduleAfter is how long a worker can be down before its tasks
+	// are run somewhere else
+	RescheduleAfter time.Duration
+	// Lost maps the tasks taken off dead workers to the workers that may
+	// still run a copy, the copies are stopped when the workers come back
+	Lost map[uuid.UUID][]string
+	// Retired holds the tasks of manifests that were replaced or deleted,
+	// they no longer answer to their name while they are being stopped
+	Retired map[uuid.UUID]bool
+	// mu is held by the loops and by the API for each request, they share
+	// the workers, nodes, task maps and queue. It is never held while
+	// waiting on the network, see later.
+	mu sync.RWMutex
+	// calls are made by flush once mu is released
+	calls []func()
+	// sending lets a single SendWork place tasks at a time
+	sending sync.Mutex
+}
+
+// WorkerTimeout bounds the requests the manager makes to the workers and
+// to the health checks of their tasks, a hung one must not hold up the
+// others.
+const WorkerTimeout = 10 * time.Second
+
+// HealthRecord keeps count of the health checks of a task and whether the
+// last one passed.
+type HealthRecord struct {
+	Checks  int
+	Passed  int
+	Healthy bool
 }
 
 func New(workers []string, schedulerType string, dbType string) *Manager {
@@ -74,16 +122,39 @@ func New(workers []string, schedulerType string, dbType string) *Manager {
 		s = &scheduler.RoundRobin{Name: "roundrobin"}
 	}
 
-	return &Manager{
-		Pending:       *queue.New(),
-		Workers:       workers,
-		TaskDb:        taskDb,
-		EventDb:       eventDb,
-		WorkerTaskMap: workerTaskMap,
-		TaskWorkerMap: taskWorkerMap,
-		Scheduler:     s,
-		WorkerNodes:   nodes,
+	m := &Manager{
+		Pending:         *queue.New(),
+		Workers:         workers,
+		TaskDb:          taskDb,
+		EventDb:         eventDb,
+		CronDb:          newResourceStore[CronTask](dbType, "crontasks"),
+		WorkflowDb:      newResourceStore[Workflow](dbType, "workflows"),
+		WorkerTaskMap:   workerTaskMap,
+		TaskWorkerMap:   taskWorkerMap,
+		Scheduler:       s,
+		WorkerNodes:     nodes,
+		Client:          &http.Client{Timeout: WorkerTimeout},
+		WebhookClient:   &http.Client{Timeout: defaultWebhookTimeout},
+		ServiceDb:       newResourceStore[Service](dbType, "services"),
+		NamespaceDb:     newResourceStore[Namespace](dbType, "namespaces"),
+		Health:          make(map[uuid.UUID]*HealthRecord),
+		Lost:            make(map[uuid.UUID][]string),
+		Retired:         make(map[uuid.UUID]bool),
+		RescheduleAfter: defaultRescheduleAfter,
+	}
+	m.ensureDefaultNamespace()
+	return m
+}
+
+func newResourceStore[T any](dbType string, name string) storage.Storage {
+	if dbType == "persistent" {
+		s, err := storage.NewStore[T](fmt.Sprintf("%s.db", name), 0600, name)
+		if err == nil {
+			return s
+		}
+		log.Printf("failed to create %s storage %v\n", name, err)
 	}
+	return storage.NewInMemoryStore[T]()
 }
 
 func (m *Manager) GetTasks() []*task.Task {
@@ -96,63 +167,109 @@ func (m *Manager) GetTasks() []*task.Task {
 	return results.([]*task.Task)
 }
 
+func (m *Manager) workerURL(worker string, path string) string {
+	scheme := m.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, worker, path)
+}
+
+// UseTLS makes the manager talk https to the workers, the caller sets up
+// Client with the certificates.
+func (m *Manager) UseTLS() {
+	m.Scheme = "https"
+	for _, n := range m.WorkerNodes {
+		n.Api = m.workerURL(n.Name, "")
+	}
+}
+
+// IsWorker tells whether host, as host:port, is one of the workers.
+func (m *Manager) IsWorker(host string) bool {
+	for _, w := range m.Workers {
+		if w == host {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectWorker picks the worker to run t among the ones that answer. The
+// scheduler may ask the workers for their stats, so it works on copies of
+// the nodes and is called without the lock.
 func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
 	fmt.Println("SelectWorker")
-	candidates := m.Scheduler.SelectCandidateNodes(t, m.WorkerNodes)
-	if candidates == nil {
+	m.mu.Lock()
+	var nodes []*node.Node
+	for _, n := range m.WorkerNodes {
+		if !m.unreachable(n.Name) {
+			copied := *n
+			copied.Client = m.Client
+			nodes = append(nodes, &copied)
+		}
+	}
+	m.mu.Unlock()
+
+	candidates := m.Scheduler.SelectCandidateNodes(t, nodes)
+	if len(candidates) == 0 {
 		err := fmt.Errorf("No available candidates to match resource request for task %v", t.ID)
 		return nil, err
 	}
 	scores := m.Scheduler.Score(t, candidates)
 	chosenOne := m.Scheduler.Pick(scores, candidates)
+
+	// keep what the scheduler learned about the workers
+	m.mu.Lock()
+	for _, copied := range nodes {
+		if n := m.getNode(copied.Name); n != nil {
+			n.Memory = copied.Memory
+			n.Disk = copied.Disk
+			n.Stats = copied.Stats
+		}
+	}
+	m.mu.Unlock()
+
+	if chosenOne == nil {
+		return nil, fmt.Errorf("no worker could be scored for task %v", t.ID)
+	}
 	return chosenOne, nil
 }
+
+// SendWork takes the next event off the pending queue and sends it to a
+// worker. It is called without the lock: the scheduler and the worker are
+// called without it, it is only taken to look at and update the manager.
 func (m *Manager) SendWork() {
 	fmt.Println("SendWork")
-	if m.Pending.Len() <= 0 {
-		log.Println("No work in Queue")
-		return
-	}
-	taskEvent := m.Pending.Dequeue().(task.TaskEvent)
-	log.Printf("Pulled %v off pending queue\n", taskEvent.Task)
+	m.sending.Lock()
+	defer m.sending.Unlock()
 
-	err := m.EventDb.Put(taskEvent.ID, &taskEvent)
-	if err != nil {
-		log.Printf("\n")
-		return
-	}
-
-	taskWorker, ok := m.TaskWorkerMap[taskEvent.Task.ID]
-	if ok {
-		result, err := m.TaskDb.Get(taskEvent.Task.ID)
-		if err != nil {
-			log.Printf("unable to schedule task %v\n", err)
-			return
-		}
-		persistedTask, ok := result.(*task.Task)
-		if !ok {
-			log.Printf("unable to task to *task.Task %v\n", result)
-			return
-		}
-		if taskEvent.State == task.COMPLETED && task.ValidStateTransition(persistedTask.State, taskEvent.State) {
-			m.stopTask(taskWorker, taskEvent.Task.ID.String())
-			return
-		}
-		log.Printf("invalid request: existing task %s is in state %v and cannot transition to the completed state", persistedTask.ID.String(), persistedTask.State)
+	m.mu.Lock()
+	taskEvent, ok := m.nextWork()
+	m.mu.Unlock()
+	if !ok {
 		return
 	}
 
 	w, err := m.SelectWorker(taskEvent.Task)
+	m.mu.Lock()
 	if err != nil {
+		// keep it pending, a worker may come back or join
 		log.Printf("error selecting worker for task %s: %v\n", taskEvent.Task.ID, err)
+		m.Pending.Enqueue(taskEvent)
+		m.mu.Unlock()
+		return
+	}
+	// the task may have been cancelled while the scheduler was busy
+	if !m.wantsWork(taskEvent) {
+		m.mu.Unlock()
 		return
 	}
-
 	m.WorkerTaskMap[w.Name] = append(m.WorkerTaskMap[w.Name], taskEvent.Task.ID)
 	m.TaskWorkerMap[taskEvent.Task.ID] = w.Name
-
 	taskEvent.Task.State = task.SCHEDULED
 	m.TaskDb.Put(taskEvent.Task.ID, &taskEvent.Task)
+	m.updateNodeAllocations()
+	m.mu.Unlock()
 
 	data, err := json.Marshal(taskEvent)
 	if err != nil {
@@ -160,13 +277,16 @@ func (m *Manager) SendWork() {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s/tasks", w.Name)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	url := m.workerURL(w.Name, "/tasks")
+	resp, err := m.Client.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
-		log.Printf("failed to connect to %v: %v\n", w, err)
-		m.Pending.Enqueue(taskEvent)
+		log.Printf("failed to connect to %v: %v\n", w.Name, err)
+		m.mu.Lock()
+		m.unplace(taskEvent)
+		m.mu.Unlock()
 		return
 	}
+	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	if resp.StatusCode != http.StatusCreated {
 		e := worker.ErrResponse{}
@@ -175,6 +295,13 @@ func (m *Manager) SendWork() {
 			fmt.Printf("failed to decode response %v\n", err)
 		}
 		log.Printf("response error (%d): %s\n", e.HTTPStatusCode, e.Message)
+		m.mu.Lock()
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			m.refused(taskEvent)
+		} else {
+			m.unplace(taskEvent)
+		}
+		m.mu.Unlock()
 		return
 	}
 	newTask := task.Task{}
@@ -185,65 +312,251 @@ func (m *Manager) SendWork() {
 	}
 	log.Printf("%v\n", newTask)
 }
+
+// nextWork dequeues the next event that has to be sent to a worker. Stops
+// of placed tasks are handled right away, events no longer wanted are
+// dropped and tasks over the quota of their namespace wait their turn.
+func (m *Manager) nextWork() (task.TaskEvent, bool) {
+	if m.Pending.Len() <= 0 {
+		log.Println("No work in Queue")
+		return task.TaskEvent{}, false
+	}
+	taskEvent := m.Pending.Dequeue().(task.TaskEvent)
+	log.Printf("Pulled %v off pending queue\n", taskEvent.Task)
+
+	err := m.EventDb.Put(taskEvent.ID, &taskEvent)
+	if err != nil {
+		log.Printf("\n")
+		return taskEvent, false
+	}
+	if !m.wantsWork(taskEvent) {
+		return taskEvent, false
+	}
+
+	taskWorker, ok := m.TaskWorkerMap[taskEvent.Task.ID]
+	if !ok && taskEvent.State != task.COMPLETED && !m.fitsQuota(taskEvent.Task) {
+		log.Printf("holding task %v back, namespace %s is at its quota\n", taskEvent.Task.ID, namespaceOf(taskEvent.Task.Namespace))
+		m.Pending.Enqueue(taskEvent)
+		return taskEvent, false
+	}
+	if ok {
+		result, err := m.TaskDb.Get(taskEvent.Task.ID)
+		if err != nil {
+			log.Printf("unable to schedule task %v\n", err)
+			return taskEvent, false
+		}
+		persistedTask, ok := result.(*task.Task)
+		if !ok {
+			log.Printf("unable to task to *task.Task %v\n", result)
+			return taskEvent, false
+		}
+		if taskEvent.State == task.COMPLETED && task.ValidStateTransition(persistedTask.State, taskEvent.State) {
+			m.stopTask(taskWorker, taskEvent.Task.ID.String())
+			return taskEvent, false
+		}
+		log.Printf("invalid request: existing task %s is in state %v and cannot transition to the completed state", persistedTask.ID.String(), persistedTask.State)
+		return taskEvent, false
+	}
+	return taskEvent, true
+}
+
+// wantsWork tells whether an event still has to be sent: the service or
+// the namespace of its task may be gone, or the task cancelled before it
+// was placed.
+func (m *Manager) wantsWork(taskEvent task.TaskEvent) bool {
+	if taskEvent.State != task.COMPLETED && taskEvent.Task.ServiceID != uuid.Nil {
+		_, err := m.ServiceDb.Get(taskEvent.Task.ServiceID)
+		if err != nil {
+			log.Printf("dropping task %v, its service no longer exists\n", taskEvent.Task.ID)
+			m.TaskDb.Delete(taskEvent.Task.ID)
+			return false
+		}
+	}
+
+	if _, err := m.GetNamespace(namespaceOf(taskEvent.Task.Namespace)); err != nil {
+		log.Printf("dropping task %v, its namespace no longer exists\n", taskEvent.Task.ID)
+		return false
+	}
+
+	if _, ok := m.TaskWorkerMap[taskEvent.Task.ID]; !ok {
+		result, err := m.TaskDb.Get(taskEvent.Task.ID)
+		if err == nil && result.(*task.Task).State == task.SKIPPED {
+			log.Printf("dropping task %v, it was cancelled before it ran\n", taskEvent.Task.ID)
+			return false
+		}
+	}
+	return true
+}
+
+// unplace takes back a task its worker couldn't be told about and queues
+// it again.
+func (m *Manager) unplace(taskEvent task.TaskEvent) {
+	id := taskEvent.Task.ID
+	if w, ok := m.TaskWorkerMap[id]; ok {
+		m.WorkerTaskMap[w] = remove(m.WorkerTaskMap[w], id)
+		delete(m.TaskWorkerMap, id)
+	}
+	result, err := m.TaskDb.Get(id)
+	if err != nil || result.(*task.Task).State != task.SCHEDULED {
+		// stopped or forgotten meanwhile
+		return
+	}
+	taskEvent.Task.State = task.PENDING
+	m.TaskDb.Put(id, &taskEvent.Task)
+	m.updateNodeAllocations()
+	m.Pending.Enqueue(taskEvent)
+}
+
+// refused fails a task its worker won't run, another worker would most
+// likely answer the same.
+func (m *Manager) refused(taskEvent task.TaskEvent) {
+	id := taskEvent.Task.ID
+	if w, ok := m.TaskWorkerMap[id]; ok {
+		m.WorkerTaskMap[w] = remove(m.WorkerTaskMap[w], id)
+		delete(m.TaskWorkerMap, id)
+	}
+	result, err := m.TaskDb.Get(id)
+	if err != nil || result.(*task.Task).State != task.SCHEDULED {
+		return
+	}
+	t := result.(*task.Task)
+	t.State = task.FAILED
+	t.TerminationReason = task.ReasonRejected
+	t.FinishTime = time.Now().UTC()
+	m.TaskDb.Put(id, t)
+	m.updateNodeAllocations()
+}
+
 func (m *Manager) UpdateTasks() {
 	for {
 		fmt.Printf("[Manager] Updating tasks from %d workers\n", len(m.Workers))
 		m.updateTasks()
+		m.mu.Lock()
+		m.rescheduleLostTasks(time.Now())
+		m.mu.Unlock()
+		m.flush()
 		time.Sleep(15 * time.Second)
 	}
 }
+
+// updateTasks asks every worker for its tasks. The workers are called
+// without the lock, it is taken to apply what each one answered.
 func (m *Manager) updateTasks() {
 	fmt.Println("UpdateTasks")
-	for _, workerData := range m.Workers {
+	m.mu.Lock()
+	m.checkNodes(time.Now())
+	workers := append([]string(nil), m.Workers...)
+	m.mu.Unlock()
+
+	for _, workerData := range workers {
 		log.Printf("Checking worker %v for updates\n", workerData)
-		url := fmt.Sprintf("http://%s/tasks", workerData)
-		resp, err := http.Get(url)
+		tasks, err := m.workerTasks(workerData)
 		if err != nil {
-			log.Printf("failed to connect to %v: %v\n", workerData, err)
-			continue
-		}
-		decoder := json.NewDecoder(resp.Body)
-		if resp.StatusCode != http.StatusOK {
-			e := worker.ErrResponse{}
-			err = decoder.Decode(&e)
-			if err != nil {
-				fmt.Printf("failed to decode response %v\n", err)
-			}
-			log.Printf("response error (%d): %s\n", e.HTTPStatusCode, e.Message)
+			log.Printf("%v\n", err)
 			continue
 		}
+		m.mu.Lock()
+		m.applyWorkerTasks(workerData, tasks)
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	m.updateNodeAllocations()
+	m.mu.Unlock()
+}
 
-		var tasks []*task.Task
-		err = decoder.Decode(&tasks)
+// workerTasks gets the tasks of a worker and records whether it answered.
+func (m *Manager) workerTasks(workerData string) ([]*task.Task, error) {
+	url := m.workerURL(workerData, "/tasks")
+	resp, err := m.Client.Get(url)
+	m.mu.Lock()
+	m.nodeSeen(workerData, err)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %v: %v", workerData, err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		e := worker.ErrResponse{}
+		err = decoder.Decode(&e)
 		if err != nil {
 			fmt.Printf("failed to decode response %v\n", err)
-			return
 		}
+		return nil, fmt.Errorf("response error (%d): %s", e.HTTPStatusCode, e.Message)
+	}
 
-		for _, t := range tasks {
-			result, err := m.TaskDb.Get(t.ID)
-			if err != nil {
-				log.Printf("[manager] %s\n", err)
-				continue
-			}
+	var tasks []*task.Task
+	err = decoder.Decode(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response %v", err)
+	}
+	return tasks, nil
+}
 
-			taskPersisted, ok := result.(*task.Task)
-			if !ok {
-				log.Printf("cannot convert result %v to *task.Task type\n", result)
-				continue
-			}
+// applyWorkerTasks updates the tasks of the manager with what a worker
+// reported about them.
+func (m *Manager) applyWorkerTasks(workerData string, tasks []*task.Task) {
+	for _, t := range tasks {
+		placed, ok := m.TaskWorkerMap[t.ID]
+		if placed != workerData && m.lostCopy(t.ID, workerData) {
+			m.stopLostTask(workerData, t)
+			continue
+		}
+		// copies left behind by a lost task don't speak for it
+		if ok && placed != workerData {
+			continue
+		}
+		result, err := m.TaskDb.Get(t.ID)
+		if err != nil {
+			log.Printf("[manager] %s\n", err)
+			continue
+		}
 
-			if taskPersisted.State != t.State {
-				taskPersisted.State = t.State
-			}
+		taskPersisted, ok := result.(*task.Task)
+		if !ok {
+			log.Printf("cannot convert result %v to *task.Task type\n", result)
+			continue
+		}
+		if placed == "" && taskPersisted.TerminationReason == task.ReasonLost {
+			continue
+		}
 
-			taskPersisted.StartTime = t.StartTime
-			taskPersisted.FinishTime = t.FinishTime
-			taskPersisted.ContainerID = t.ContainerID
-			taskPersisted.HostPorts = t.HostPorts
+		if taskPersisted.State != t.State {
+			taskPersisted.State = t.State
+		}
+
+		taskPersisted.StartTime = t.StartTime
+		taskPersisted.FinishTime = t.FinishTime
+		taskPersisted.ContainerID = t.ContainerID
+		taskPersisted.HostPorts = t.HostPorts
+		taskPersisted.DiskUsage = t.DiskUsage
+		taskPersisted.ExitCode = t.ExitCode
+		taskPersisted.TerminationReason = t.TerminationReason
 
-			m.TaskDb.Put(t.ID, taskPersisted)
+		m.TaskDb.Put(t.ID, taskPersisted)
+	}
+}
+
+// updateNodeAllocations recomputes how much disk is taken on each node by
+// the tasks placed there. A task counts for what it asked for, or for what
+// it really uses if it went over its request.
+func (m *Manager) updateNodeAllocations() {
+	allocated := make(map[string]int64)
+	for _, t := range m.GetTasks() {
+		if t.State != task.SCHEDULED && t.State != task.RUNNING {
+			continue
 		}
+		w, ok := m.TaskWorkerMap[t.ID]
+		if !ok {
+			continue
+		}
+		allocated[w] += max(t.Disk, t.DiskUsage)
+	}
+
+	for _, n := range m.WorkerNodes {
+		n.DiskAllocated = allocated[n.Name]
 	}
 }
 
@@ -251,12 +564,114 @@ func (m *Manager) ProcessTasks() {
 	for {
 		log.Println("Processing any tasks in the queue")
 		m.SendWork()
+		m.flush()
 		log.Println("Sleeping for 10 seconds")
 		time.Sleep(10 * time.Second)
 	}
 
 }
 
+// Step runs a single pass of the manager loops without sleeping in
+// between, which lets a caller drive the manager deterministically.
+func (m *Manager) Step() {
+	m.flush()
+	m.mu.Lock()
+	m.runCronTasks(time.Now())
+	m.advanceWorkflows()
+	m.reconcileServices()
+	m.mu.Unlock()
+	m.flush()
+
+	m.mu.RLock()
+	pending := m.Pending.Len()
+	m.mu.RUnlock()
+	for i := 0; i < pending; i++ {
+		m.SendWork()
+	}
+	m.flush()
+
+	m.updateTasks()
+	m.mu.Lock()
+	m.rescheduleLostTasks(time.Now())
+	m.mu.Unlock()
+	m.flush()
+	m.doHealthChecks()
+	m.flush()
+}
+
+// later queues a call that waits on the network, made by flush once the
+// lock is released. It is called with the lock held, the call takes it
+// again if it has to apply what it learned.
+func (m *Manager) later(call func()) {
+	m.calls = append(m.calls, call)
+}
+
+// flush makes the calls queued by later, along with the ones they queue
+// themselves. It is called without the lock.
+func (m *Manager) flush() {
+	for {
+		m.mu.Lock()
+		calls := m.calls
+		m.calls = nil
+		m.mu.Unlock()
+		if len(calls) == 0 {
+			return
+		}
+		for _, call := range calls {
+			call()
+		}
+	}
+}
+
+// PrepareTaskEvent fills in what a client can leave out of a new task
+// event, IDs, name, timestamp and states, and checks the rest. The task
+// always starts PENDING, its state is the manager's business.
+func (m *Manager) PrepareTaskEvent(te *task.TaskEvent) task.FieldErrors {
+	if te.ID == uuid.Nil {
+		te.ID = uuid.New()
+	}
+	if te.Timestamp.IsZero() {
+		te.Timestamp = time.Now()
+	}
+	if te.State == task.PENDING {
+		te.State = task.RUNNING
+	}
+	if te.Task.ID == uuid.Nil {
+		te.Task.ID = uuid.New()
+	}
+	if te.Task.Name == "" {
+		te.Task.Name = te.Task.DefaultName()
+	}
+	te.Task.Namespace = namespaceOf(te.Task.Namespace)
+
+	errs := te.Task.Validate().Prefix("Task")
+	if te.State != task.RUNNING {
+		errs.Add("State", "a new task can only be asked to be Running")
+	}
+	errs = append(errs, m.taken(*te)...)
+	if _, err := m.GetNamespace(te.Task.Namespace); err != nil {
+		errs.Add("Task.Namespace", "%v", err)
+	}
+	te.Task.State = task.PENDING
+	return errs
+}
+
+// taken tells which of the IDs and the name of a new task event are
+// already used.
+func (m *Manager) taken(te task.TaskEvent) task.FieldErrors {
+	var errs task.FieldErrors
+	if _, err := m.TaskDb.Get(te.Task.ID); err == nil {
+		errs.Add("Task.ID", "task %v already exists", te.Task.ID)
+	}
+	if _, err := m.EventDb.Get(te.ID); err == nil {
+		errs.Add("ID", "event %v already exists", te.ID)
+	}
+	if _, ok := m.taskByName(te.Task.Namespace, te.Task.Name); ok {
+		errs.Add("Task.Name", "task %s already exists in namespace %s", te.Task.Name, te.Task.Namespace)
+	}
+	return errs
+}
+
 func (m *Manager) AddTask(te task.TaskEvent) {
 	m.Pending.Enqueue(te)
 }
@@ -268,9 +683,10 @@ func getHostPort(ports nat.PortMap) *string {
 	return nil
 }
 
-func (m *Manager) checkHealthTask(t task.Task) error {
+// checkHealthTask calls the health check of a task running on worker. It
+// is called without the lock.
+func (m *Manager) checkHealthTask(t task.Task, w string) error {
 	log.Printf("calling health check for task %v: %s\n", t.ID, t.HealthCheck)
-	w := m.TaskWorkerMap[t.ID]
 	hostPort := getHostPort(t.HostPorts)
 	if hostPort == nil {
 		err := fmt.Errorf("nil hostport")
@@ -281,12 +697,13 @@ func (m *Manager) checkHealthTask(t task.Task) error {
 	url := fmt.Sprintf("http://%s:%s%s", worker[0], *hostPort, t.HealthCheck)
 	log.Printf("calling health check for task %v: %s\n", t.ID, url)
 
-	resp, err := http.Get(url)
+	resp, err := m.Client.Get(url)
 	if err != nil {
 		msg := fmt.Errorf("Error connecting to Health check %s %v\n", url, err)
 		log.Printf(msg.Error())
 		return msg
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		msg := fmt.Errorf("Error Health check for task %s, did not return 200\n", t.ID)
@@ -298,20 +715,83 @@ func (m *Manager) checkHealthTask(t task.Task) error {
 	return nil
 }
 
+const maxRestarts = 3
+
+// doHealthChecks restarts the failed tasks and checks the health of the
+// running ones. The health checks are called without the lock, each
+// result is applied if the task is still running where it was checked.
 func (m *Manager) doHealthChecks() {
+	type healthCheck struct {
+		task   task.Task
+		worker string
+	}
+	var checks []healthCheck
+
+	m.mu.Lock()
 	for _, t := range m.GetTasks() {
-		if t.State == task.RUNNING && t.RestartCount < 3 {
-			err := m.checkHealthTask(*t)
-			if err != nil {
-				m.restartTask(t)
-			}
-		} else if t.State == task.FAILED && t.RestartCount < 3 {
+		w := m.TaskWorkerMap[t.ID]
+		// nothing can be checked or restarted on a worker that is gone
+		if m.unreachable(w) {
+			continue
+		}
+		// jobs are not servers, the exit code tells how they did
+		if t.State == task.RUNNING && t.RestartCount < maxRestarts && !t.IsJob() {
+			checks = append(checks, healthCheck{task: *t, worker: w})
+		} else if t.State == task.FAILED && t.RestartCount < maxRestarts && t.ShouldRestart() {
 			m.restartTask(t)
 		}
 	}
+	m.mu.Unlock()
+
+	for _, c := range checks {
+		err := m.checkHealthTask(c.task, c.worker)
+		m.mu.Lock()
+		result, getErr := m.TaskDb.Get(c.task.ID)
+		if getErr == nil {
+			t := result.(*task.Task)
+			if t.State == task.RUNNING && m.TaskWorkerMap[t.ID] == c.worker {
+				m.recordHealth(t.ID, err == nil)
+				if err != nil {
+					m.restartTask(t)
+				}
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// gaveUp tells whether a failed task is done for good, it won't be
+// restarted by the health checks anymore.
+func gaveUp(t *task.Task) bool {
+	return t.State == task.FAILED && (t.RestartCount >= maxRestarts || !t.ShouldRestart())
 }
 
+func (m *Manager) recordHealth(id uuid.UUID, healthy bool) {
+	r, ok := m.Health[id]
+	if !ok {
+		r = &HealthRecord{}
+		m.Health[id] = r
+	}
+	r.Checks++
+	if healthy {
+		r.Passed++
+	}
+	r.Healthy = healthy
+}
+
+// restartTask runs a task again on its worker, which is told about it
+// once the lock is released.
 func (m *Manager) restartTask(t *task.Task) {
+	if t.ServiceID != uuid.Nil {
+		if _, err := m.ServiceDb.Get(t.ServiceID); err != nil {
+			log.Printf("not restarting task %v, its service no longer exists\n", t.ID)
+			return
+		}
+	}
+	if m.Retired[t.ID] {
+		log.Printf("not restarting task %v, it was replaced or deleted\n", t.ID)
+		return
+	}
 	w := m.TaskWorkerMap[t.ID]
 	t.State = task.SCHEDULED
 	t.RestartCount++
@@ -330,64 +810,151 @@ func (m *Manager) restartTask(t *task.Task) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s/tasks", w)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		log.Printf("Unable to connect to %v %v\n", w, err)
-		m.Pending.Enqueue(t)
-		return
-	}
-	decoder := json.NewDecoder(resp.Body)
-	if resp.StatusCode != http.StatusCreated {
-		e := worker.ErrResponse{}
-		err = decoder.Decode(&e)
+	url := m.workerURL(w, "/tasks")
+	m.later(func() {
+		resp, err := m.Client.Post(url, "application/json", bytes.NewBuffer(data))
 		if err != nil {
-			fmt.Printf("Error decoding response %v\n", err)
+			log.Printf("Unable to connect to %v %v\n", w, err)
+			return
+		}
+		defer resp.Body.Close()
+		decoder := json.NewDecoder(resp.Body)
+		if resp.StatusCode != http.StatusCreated {
+			e := worker.ErrResponse{}
+			err = decoder.Decode(&e)
+			if err != nil {
+				fmt.Printf("Error decoding response %v\n", err)
+				return
+			}
+			log.Printf("response error (%d) %s\n", e.HTTPStatusCode, e.Message)
 			return
 		}
-		log.Printf("response error (%d) %s\n", e.HTTPStatusCode, e.Message)
-		return
-	}
 
-	newTask := task.Task{}
-	err = decoder.Decode(&newTask)
-	if err != nil {
-		fmt.Printf("Error decoding response %v\n", err)
-		return
-	}
+		newTask := task.Task{}
+		err = decoder.Decode(&newTask)
+		if err != nil {
+			fmt.Printf("Error decoding response %v\n", err)
+			return
+		}
 
-	log.Printf("%v\n", newTask)
+		log.Printf("%v\n", newTask)
+	})
 }
 
 func (m *Manager) DoHealthChecks() {
 	for {
 		log.Println("Performing task health check")
 		m.doHealthChecks()
+		m.flush()
 		log.Println("Task health checks completed")
 		log.Println("Sleeping for 60 seconds")
 		time.Sleep(60 * time.Second)
 	}
 }
 
-func (m *Manager) stopTask(worker string, taskID string) {
-	client := &http.Client{}
-	url := fmt.Sprintf("http://%s/tasks/%s", worker, taskID)
-	req, err := http.NewRequest("DELETE", url, nil)
+// TaskWorker returns the worker a task was placed on.
+func (m *Manager) TaskWorker(taskID uuid.UUID) (string, error) {
+	w, ok := m.TaskWorkerMap[taskID]
+	if !ok {
+		return "", fmt.Errorf("task %v is not assigned to any worker", taskID)
+	}
+	return w, nil
+}
+
+// TaskLogs asks worker w for the logs of a task. The query is passed
+// through untouched, the caller owns the body of the response.
+// It is called without the lock, logs can be followed for as long as the
+// caller wants.
+func (m *Manager) TaskLogs(ctx context.Context, w string, taskID uuid.UUID, query string) (*http.Response, error) {
+	url := m.workerURL(w, fmt.Sprintf("/tasks/%s/logs?%s", taskID, query))
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		log.Printf("error creating request to delete task %s: %v", taskID, err)
-		return
+		return nil, err
 	}
+	return m.streamingClient().Do(req)
+}
 
-	resp, err := client.Do(req)
+// ExecTask opens an exec session for a task on worker w. When the worker
+// accepts it the response has status 101 and its body is the upgraded
+// connection. Like TaskLogs it is called without the lock.
+func (m *Manager) ExecTask(ctx context.Context, w string, taskID uuid.UUID, body []byte) (*http.Response, error) {
+	url := m.workerURL(w, fmt.Sprintf("/tasks/%s/exec", taskID))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		log.Printf("error connecting to worker at %s: %v", url, err)
-		return
+		return nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", utils.ExecProtocol)
+	return m.streamingClient().Do(req)
+}
 
-	if resp.StatusCode != 204 {
-		log.Printf("Error sending request: %v", err)
-		return
+// streamingClient is Client without its timeout, for the logs and exec
+// sessions that last as long as the user wants.
+func (m *Manager) streamingClient() *http.Client {
+	client := *m.Client
+	client.Timeout = 0
+	return &client
+}
+
+// cancelTask makes sure a task that hasn't finished never runs or stops
+// running. A task still waiting in the pending queue is skipped, SendWork
+// drops its event, the others are stopped on their worker.
+func (m *Manager) cancelTask(t *task.Task) {
+	switch t.State {
+	case task.PENDING:
+		result, err := m.TaskDb.Get(t.ID)
+		if err != nil {
+			return
+		}
+		persisted := result.(*task.Task)
+		persisted.State = task.SKIPPED
+		persisted.FinishTime = time.Now().UTC()
+		m.TaskDb.Put(persisted.ID, persisted)
+		*t = *persisted
+	case task.SCHEDULED, task.RUNNING:
+		taskCopy := *t
+		taskCopy.State = task.COMPLETED
+		m.AddTask(task.TaskEvent{
+			ID:        uuid.New(),
+			State:     task.COMPLETED,
+			Timestamp: time.Now(),
+			Task:      taskCopy,
+		})
 	}
+}
+
+func (m *Manager) stopTask(worker string, taskID string) {
+	m.deleteTask(worker, taskID, "")
+}
+
+// purgeTask has the worker stop a task and forget it along with its logs.
+func (m *Manager) purgeTask(worker string, taskID string) {
+	m.deleteTask(worker, taskID, "?purge=true")
+}
+
+// deleteTask asks a worker to stop a task once the lock is released.
+func (m *Manager) deleteTask(worker string, taskID string, query string) {
+	url := m.workerURL(worker, fmt.Sprintf("/tasks/%s%s", taskID, query))
+	m.later(func() {
+		req, err := http.NewRequest("DELETE", url, nil)
+		if err != nil {
+			log.Printf("error creating request to delete task %s: %v", taskID, err)
+			return
+		}
+
+		resp, err := m.Client.Do(req)
+		if err != nil {
+			log.Printf("error connecting to worker at %s: %v", url, err)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != 204 {
+			log.Printf("Error sending request: %v", err)
+			return
+		}
 
-	log.Printf("task %s has been scheduled to be stopped", taskID)
+		log.Printf("task %s has been scheduled to be stopped", taskID)
+	})
 }
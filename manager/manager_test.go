@@ -0,0 +1,201 @@
+package manager_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/node"
+	"github.com/jhonnyV-V/orch-in-go/task"
+	"github.com/jhonnyV-V/orch-in-go/utils"
+	"github.com/jhonnyV-V/orch-in-go/worker"
+)
+
+// hangingChecks holds the health checks of the cluster until released,
+// the calls to the worker APIs go through.
+type hangingChecks struct {
+	c       *fake.Cluster
+	hung    chan struct{}
+	release chan struct{}
+}
+
+func (h *hangingChecks) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := h.c.Workers[req.URL.Host]; !ok {
+		h.hung <- struct{}{}
+		<-h.release
+	}
+	return h.c.RoundTrip(req)
+}
+
+func TestHungHealthChecksDontBlockTheManager(t *testing.T) {
+	c := fake.NewCluster(1)
+	te, err := c.Submit(web("web:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runningOn(t, c, te.Task.ID)
+
+	h := &hangingChecks{c: c, hung: make(chan struct{}), release: make(chan struct{})}
+	c.Manager.Client = &http.Client{Transport: h}
+	done := make(chan struct{})
+	go func() {
+		c.Manager.Step()
+		close(done)
+	}()
+	<-h.hung
+
+	beat := make(chan error)
+	go func() {
+		beat <- c.Manager.Heartbeat(node.Heartbeat{Name: "worker-1", Address: "worker-1"})
+	}()
+	select {
+	case err := <-beat:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("heartbeat waited on a hung health check")
+	}
+
+	close(h.release)
+	<-done
+	if state := c.Task(te.Task.ID).State; state != task.RUNNING {
+		t.Fatalf("task is %v after its health check passed", state)
+	}
+}
+
+func TestExecGoesThroughTheManagerApi(t *testing.T) {
+	c := fake.NewCluster(1)
+	defer c.Close()
+	c.Runtimes["worker-1"].SetBehavior("shell", fake.Behavior{
+		Exec: func(cmd []string, stdin io.Reader, stdout, stderr io.Writer) int {
+			fmt.Fprint(stdout, strings.Join(cmd, " "))
+			return 3
+		},
+	})
+	te, err := c.Submit(task.Task{Name: "shell", Image: "shell"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runningOn(t, c, te.Task.ID)
+
+	s := httptest.NewServer(c.ManagerApi.Handler())
+	defer s.Close()
+	// a client timeout would hide the upgraded connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	body, _ := json.Marshal(worker.ExecRequest{Cmd: []string{"echo", "hi"}})
+	req, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/tasks/%s/exec", s.URL, te.Task.ID), bytes.NewBuffer(body))
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", utils.ExecProtocol)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("exec answered %d", resp.StatusCode)
+	}
+	conn := resp.Body.(io.ReadWriteCloser)
+	utils.WriteFrame(conn, utils.StreamStdin, nil)
+
+	var out string
+	for {
+		stream, p, err := utils.ReadFrame(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stream == utils.StreamStdout {
+			out += string(p)
+		}
+		if stream == utils.StreamExit {
+			if string(p) != "3" || out != "echo hi" {
+				t.Fatalf("exec printed %q and exited with %s", out, p)
+			}
+			break
+		}
+	}
+
+	// the manager lock was given back
+	client := &http.Client{Timeout: 5 * time.Second}
+	tasks, err := client.Get(s.URL + "/tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks.Body.Close()
+}
+
+func TestLogsGoThroughTheManagerApi(t *testing.T) {
+	c := fake.NewCluster(1)
+	c.Runtimes["worker-1"].SetBehavior("web", fake.Behavior{Logs: "started\n"})
+	te, err := c.Submit(task.Task{Name: "web", Image: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runningOn(t, c, te.Task.ID)
+
+	s := httptest.NewServer(c.ManagerApi.Handler())
+	defer s.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%s/tasks/%s/logs", s.URL, te.Task.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(logs) != "started\n" {
+		t.Fatalf("logs answered %d: %q", resp.StatusCode, logs)
+	}
+}
+
+// refusingWorkers answers the tasks sent to the workers with status while
+// refusals last.
+type refusingWorkers struct {
+	c        *fake.Cluster
+	status   int
+	refusals int
+}
+
+func (r *refusingWorkers) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := r.c.Workers[req.URL.Host]; ok && req.Method == "POST" && req.URL.Path == "/tasks" && r.refusals > 0 {
+		r.refusals--
+		rec := httptest.NewRecorder()
+		rec.WriteHeader(r.status)
+		json.NewEncoder(rec).Encode(worker.ErrResponse{HTTPStatusCode: r.status, Message: "refused"})
+		return rec.Result(), nil
+	}
+	return r.c.RoundTrip(req)
+}
+
+func TestRefusedTasksFail(t *testing.T) {
+	c := fake.NewCluster(1)
+	c.Manager.Client = &http.Client{Transport: &refusingWorkers{c: c, status: http.StatusForbidden, refusals: 1}}
+	te, err := c.Submit(web("web:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Step()
+	tk := c.Task(te.Task.ID)
+	if tk.State != task.FAILED || tk.TerminationReason != task.ReasonRejected || c.WorkerOf(te.Task.ID) != "" {
+		t.Fatalf("refused task is %v (%s) on %q", tk.State, tk.TerminationReason, c.WorkerOf(te.Task.ID))
+	}
+}
+
+func TestTasksAWorkerFailedToTakeAreSentAgain(t *testing.T) {
+	c := fake.NewCluster(1)
+	c.Manager.Client = &http.Client{Transport: &refusingWorkers{c: c, status: http.StatusInternalServerError, refusals: 1}}
+	te, err := c.Submit(web("web:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runningOn(t, c, te.Task.ID)
+}
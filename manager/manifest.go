@@ -0,0 +1,534 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of resources a manifest can describe.
+const (
+	KindTask     = "Task"
+	KindService  = "Service"
+	KindCronTask = "CronTask"
+)
+
+// What applying or deleting a manifest did, or would do on a dry run.
+const (
+	ActionCreated    = "created"
+	ActionConfigured = "configured"
+	ActionUnchanged  = "unchanged"
+	ActionDeleted    = "deleted"
+	ActionNotFound   = "not found"
+)
+
+// Manifest describes a resource by its kind and name. Spec holds the
+// fields of the resource as they would be posted to its endpoint.
+type Manifest struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Spec      json.RawMessage
+}
+
+// Change is the outcome of a manifest. Diff lists the fields that changed,
+// prefixed with + when added, - when removed and ~ when modified.
+type Change struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Action    string
+	Diff      []string
+}
+
+// ParseManifests reads a stream of YAML documents separated by ---. Field
+// names match the ones of the JSON API, case insensitively.
+func ParseManifests(data []byte) ([]Manifest, error) {
+	var manifests []Manifest
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 1; ; i++ {
+		var doc map[string]interface{}
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+		if doc == nil {
+			continue
+		}
+
+		// yaml and json share their data model, going through json lets
+		// the spec be decoded like the API bodies are
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+		m := Manifest{}
+		err = json.Unmarshal(data, &m)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// resource is a manifest decoded into the spec of its kind.
+type resource struct {
+	Manifest
+	spec interface{}
+}
+
+func decodeSpec(m Manifest, v interface{}) error {
+	if len(m.Spec) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(m.Spec))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// decodeManifest turns a manifest into the spec of its kind, with the
+// defaults the manager would apply, so it can be compared with what is
+// already running.
+func decodeManifest(m Manifest) (resource, error) {
+	if m.Name == "" {
+		return resource{}, fmt.Errorf("%s manifest without a name", m.Kind)
+	}
+
+	var spec interface{}
+	var err error
+	switch m.Kind {
+	case KindTask:
+		t := task.Task{}
+		err = decodeSpec(m, &t)
+		if errs := t.Validate(); err == nil && len(errs) > 0 {
+			err = errs
+		}
+		t.Name = m.Name
+		t.Namespace = m.Namespace
+		spec = taskSpec(t)
+	case KindService:
+		s := Service{}
+		err = decodeSpec(m, &s)
+		s.Name = m.Name
+		s.Namespace = m.Namespace
+		s.Template.Kind = task.KindService
+		if err == nil {
+			err = s.Validate()
+		}
+		spec = serviceSpec(&s)
+	case KindCronTask:
+		c := CronTask{}
+		err = decodeSpec(m, &c)
+		c.Name = m.Name
+		c.Namespace = m.Namespace
+		c.setDefaults()
+		if err == nil {
+			err = c.Validate()
+		}
+		spec = cronTaskSpec(&c)
+	default:
+		err = fmt.Errorf("unknown kind %q", m.Kind)
+	}
+	if err != nil {
+		return resource{}, fmt.Errorf("%s/%s: %v", strings.ToLower(m.Kind), m.Name, err)
+	}
+	return resource{Manifest: m, spec: spec}, nil
+}
+
+// taskSpec drops from a task everything the manager and the workers fill
+// in while running it.
+func taskSpec(t task.Task) task.Task {
+	return task.Task{
+		Name:          t.Name,
+		Namespace:     namespaceOf(t.Namespace),
+		Image:         t.Image,
+		Memory:        t.Memory,
+		Disk:          t.Disk,
+		Cpu:           t.Cpu,
+		ExposedPorts:  t.ExposedPorts,
+		PortBindings:  t.PortBindings,
+		RestartPolicy: t.RestartPolicy,
+		HealthCheck:   t.HealthCheck,
+		Kind:          t.Kind,
+		Runtime:       t.Runtime,
+		Entrypoint:    t.Entrypoint,
+		Cmd:           t.Cmd,
+		Env:           t.Env,
+		WorkingDir:    t.WorkingDir,
+		User:          t.User,
+		Mounts:        t.Mounts,
+		VolumePolicy:  t.VolumePolicy,
+	}
+}
+
+func serviceSpec(s *Service) Service {
+	return Service{
+		Name:      s.Name,
+		Namespace: namespaceOf(s.Namespace),
+		Replicas:  s.Replicas,
+		Template:  s.Template,
+		Strategy:  s.Strategy,
+	}
+}
+
+func cronTaskSpec(c *CronTask) CronTask {
+	return CronTask{
+		Name:                       c.Name,
+		Namespace:                  namespaceOf(c.Namespace),
+		Schedule:                   c.Schedule,
+		Template:                   c.Template,
+		ConcurrencyPolicy:          c.ConcurrencyPolicy,
+		SuccessfulRunsHistoryLimit: c.SuccessfulRunsHistoryLimit,
+		FailedRunsHistoryLimit:     c.FailedRunsHistoryLimit,
+		Suspend:                    c.Suspend,
+	}
+}
+
+// taskByName finds a task of a namespace, not started by a service, that
+// is still running or about to. Retired tasks are left out, they are on
+// their way out.
+func (m *Manager) taskByName(ns string, name string) (*task.Task, bool) {
+	for _, t := range m.NamespaceTasks(ns) {
+		if t.Name != name || t.ServiceID != uuid.Nil || m.Retired[t.ID] {
+			continue
+		}
+		switch t.State {
+		case task.PENDING, task.SCHEDULED, task.RUNNING:
+			return t, true
+		case task.FAILED:
+			if !gaveUp(t) {
+				return t, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (m *Manager) cronTaskByName(ns string, name string) (*CronTask, bool) {
+	for _, c := range m.GetCronTasks() {
+		if c.Name == name && namespaceOf(c.Namespace) == ns {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// current returns the spec of the resource with the same kind and name
+// as r, if there is one.
+func (m *Manager) current(r resource) (interface{}, bool) {
+	switch r.Kind {
+	case KindTask:
+		if t, ok := m.taskByName(r.Namespace, r.Name); ok {
+			return taskSpec(*t), true
+		}
+	case KindService:
+		if s, ok := m.GetServiceByName(r.Namespace, r.Name); ok {
+			return serviceSpec(s), true
+		}
+	case KindCronTask:
+		if c, ok := m.cronTaskByName(r.Namespace, r.Name); ok {
+			return cronTaskSpec(c), true
+		}
+	}
+	return nil, false
+}
+
+// scopeManifests puts manifests without a namespace in ns, the ones
+// naming another namespace are refused.
+func scopeManifests(ns string, manifests []Manifest) error {
+	for i := range manifests {
+		mf := &manifests[i]
+		if mf.Namespace != "" && mf.Namespace != ns {
+			return fmt.Errorf("%s/%s: namespace %s does not match namespace %s of the request", strings.ToLower(mf.Kind), mf.Name, mf.Namespace, ns)
+		}
+		mf.Namespace = ns
+	}
+	return nil
+}
+
+// Apply creates the resources of the manifests that don't exist yet in
+// namespace ns and updates the ones whose spec changed. Nothing is
+// touched when any of the manifests is invalid, or when dryRun is set.
+func (m *Manager) Apply(ns string, manifests []Manifest, dryRun bool) ([]Change, error) {
+	err := scopeManifests(ns, manifests)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := decodeManifests(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for _, r := range resources {
+		change := Change{Kind: r.Kind, Name: r.Name, Namespace: r.Namespace}
+		current, found := m.current(r)
+		switch {
+		case !found:
+			change.Action = ActionCreated
+			change.Diff = diffSpecs(nil, r.spec)
+		default:
+			change.Diff = diffSpecs(current, r.spec)
+			change.Action = ActionConfigured
+			if len(change.Diff) == 0 {
+				change.Action = ActionUnchanged
+			}
+		}
+
+		if !dryRun && change.Action != ActionUnchanged {
+			err := m.applyResource(r)
+			if err != nil {
+				return changes, fmt.Errorf("%s/%s: %w", strings.ToLower(r.Kind), r.Name, err)
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// manifestTasks returns the task specs of the manifests that decode, Apply
+// reports the others.
+func manifestTasks(manifests []Manifest) []task.Task {
+	var tasks []task.Task
+	for _, mf := range manifests {
+		r, err := decodeManifest(mf)
+		if err != nil {
+			continue
+		}
+		switch spec := r.spec.(type) {
+		case task.Task:
+			tasks = append(tasks, spec)
+		case Service:
+			tasks = append(tasks, spec.Template)
+		case CronTask:
+			tasks = append(tasks, spec.Template)
+		}
+	}
+	return tasks
+}
+
+func decodeManifests(manifests []Manifest) ([]resource, error) {
+	var resources []resource
+	seen := make(map[string]bool)
+	for _, mf := range manifests {
+		r, err := decodeManifest(mf)
+		if err != nil {
+			return nil, err
+		}
+		key := r.Kind + "/" + r.Name
+		if seen[key] {
+			return nil, fmt.Errorf("%s/%s is defined twice", strings.ToLower(r.Kind), r.Name)
+		}
+		seen[key] = true
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+func (m *Manager) applyResource(r resource) error {
+	switch spec := r.spec.(type) {
+	case task.Task:
+		// tasks can't be changed in place, the old one is hidden from
+		// its name and stopped once the webhooks admit the new one
+		old := uuid.Nil
+		if t, found := m.taskByName(r.Namespace, r.Name); found {
+			old = t.ID
+			m.Retired[old] = true
+		}
+		err := m.startNamedTask(spec, old)
+		if err != nil {
+			delete(m.Retired, old)
+		}
+		return err
+	case Service:
+		if s, ok := m.GetServiceByName(r.Namespace, r.Name); ok {
+			_, err := m.UpdateService(s.ID, spec)
+			return err
+		}
+		_, err := m.AddService(spec)
+		return err
+	case CronTask:
+		if c, ok := m.cronTaskByName(r.Namespace, r.Name); ok {
+			spec.ID = c.ID
+		}
+		_, err := m.AddCronTask(spec)
+		return err
+	}
+	return nil
+}
+
+// startNamedTask submits the task of a manifest like POST /tasks would,
+// through validation, the admission webhooks and the quota, in place of
+// task old if there is one.
+func (m *Manager) startNamedTask(t task.Task, old uuid.UUID) error {
+	te := task.TaskEvent{State: task.RUNNING, Task: t}
+	if errs := m.PrepareTaskEvent(&te); len(errs) > 0 {
+		return errs
+	}
+	err := m.replaceTask(te, old)
+	if err != nil {
+		return err
+	}
+	log.Printf("started task %s (%v)\n", te.Task.Name, te.Task.ID)
+	return nil
+}
+
+// retireTask stops a task replaced or deleted through a manifest. It won't
+// be restarted, nor found by its name again.
+func (m *Manager) retireTask(t *task.Task) {
+	m.Retired[t.ID] = true
+	m.cancelTask(t)
+	log.Printf("stopping task %s (%v)\n", t.Name, t.ID)
+}
+
+// retire is retireTask by ID, for a task that may be gone meanwhile.
+func (m *Manager) retire(id uuid.UUID) {
+	if id == uuid.Nil {
+		return
+	}
+	result, err := m.TaskDb.Get(id)
+	if err != nil {
+		delete(m.Retired, id)
+		return
+	}
+	m.retireTask(result.(*task.Task))
+}
+
+// DeleteManifests deletes the resources of namespace ns named by the
+// manifests, their specs are ignored.
+func (m *Manager) DeleteManifests(ns string, manifests []Manifest) ([]Change, error) {
+	err := scopeManifests(ns, manifests)
+	if err != nil {
+		return nil, err
+	}
+	for _, mf := range manifests {
+		switch mf.Kind {
+		case KindTask, KindService, KindCronTask:
+		default:
+			return nil, fmt.Errorf("%s/%s: unknown kind %q", strings.ToLower(mf.Kind), mf.Name, mf.Kind)
+		}
+	}
+
+	changes := []Change{}
+	for _, mf := range manifests {
+		change := Change{Kind: mf.Kind, Name: mf.Name, Namespace: mf.Namespace, Action: ActionNotFound}
+		switch mf.Kind {
+		case KindTask:
+			if t, ok := m.taskByName(mf.Namespace, mf.Name); ok {
+				m.retireTask(t)
+				change.Action = ActionDeleted
+			}
+		case KindService:
+			if s, ok := m.GetServiceByName(mf.Namespace, mf.Name); ok {
+				err := m.DeleteService(s.ID)
+				if err != nil {
+					return changes, err
+				}
+				change.Action = ActionDeleted
+			}
+		case KindCronTask:
+			if c, ok := m.cronTaskByName(mf.Namespace, mf.Name); ok {
+				err := m.DeleteCronTask(c.ID)
+				if err != nil {
+					return changes, err
+				}
+				change.Action = ActionDeleted
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// diffSpecs compares two specs field by field, nested fields are joined
+// with dots.
+func diffSpecs(current, desired interface{}) []string {
+	before := flatten(current)
+	after := flatten(desired)
+
+	var keys []string
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var diff []string
+	for _, k := range keys {
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		switch {
+		case !inBefore:
+			diff = append(diff, fmt.Sprintf("+ %s: %s", k, a))
+		case !inAfter:
+			diff = append(diff, fmt.Sprintf("- %s: %s", k, b))
+		case a != b:
+			diff = append(diff, fmt.Sprintf("~ %s: %s -> %s", k, b, a))
+		}
+	}
+	return diff
+}
+
+// flatten maps the path of every leaf of v, as encoded in JSON, to its
+// value. Zero values are left out, a field set to its zero value is the
+// same as a field not set.
+func flatten(v interface{}) map[string]string {
+	leaves := make(map[string]string)
+	if v == nil {
+		return leaves
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return leaves
+	}
+	var doc interface{}
+	json.Unmarshal(data, &doc)
+
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			// empty objects are the members of sets like ExposedPorts
+			if len(v) == 0 && prefix != "" {
+				leaves[prefix] = "{}"
+			}
+			for k, child := range v {
+				if prefix != "" {
+					k = prefix + "." + k
+				}
+				walk(k, child)
+			}
+		case []interface{}:
+			for i, child := range v {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), child)
+			}
+		case nil:
+		default:
+			data, _ := json.Marshal(v)
+			switch s := string(data); s {
+			case "false", `""`, "0", `"00000000-0000-0000-0000-000000000000"`, `"0001-01-01T00:00:00Z"`:
+			default:
+				leaves[prefix] = s
+			}
+		}
+	}
+	walk("", doc)
+	return leaves
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+func decodeManifestList(w http.ResponseWriter, r *http.Request) ([]Manifest, bool) {
+	var manifests []Manifest
+	err := json.NewDecoder(r.Body).Decode(&manifests)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return nil, false
+	}
+	return manifests, true
+}
+
+// ApplyHandler creates or updates the resources of a list of manifests.
+// With ?dryRun=true it only reports what would change.
+func (a *Api) ApplyHandler(w http.ResponseWriter, r *http.Request) {
+	manifests, ok := decodeManifestList(w, r)
+	if !ok || !allowHostAccess(w, r, manifestTasks(manifests)...) {
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+	changes, err := a.Manager.Apply(namespace(r), manifests, dryRun)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to apply manifests: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(changes)
+}
+
+// DiffManifestsHandler reports what applying a list of manifests would
+// change, it only needs to read.
+func (a *Api) DiffManifestsHandler(w http.ResponseWriter, r *http.Request) {
+	manifests, ok := decodeManifestList(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := a.Manager.Apply(namespace(r), manifests, true)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to diff manifests: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(changes)
+}
+
+func (a *Api) DeleteManifestsHandler(w http.ResponseWriter, r *http.Request) {
+	manifests, ok := decodeManifestList(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := a.Manager.DeleteManifests(namespace(r), manifests)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to delete manifests: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(changes)
+}
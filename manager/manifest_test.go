@@ -0,0 +1,208 @@
+package manager_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/auth"
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// taskManifest describes a task named web running image.
+func taskManifest(image string) []manager.Manifest {
+	spec := fmt.Sprintf(`{"Image":%q}`, image)
+	return []manager.Manifest{{Kind: manager.KindTask, Name: "web", Spec: json.RawMessage(spec)}}
+}
+
+func apply(t *testing.T, c *fake.Cluster, manifests []manager.Manifest, dryRun bool) manager.Change {
+	t.Helper()
+	changes, err := c.Manager.Apply(task.DefaultNamespace, manifests, dryRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, expected 1", len(changes))
+	}
+	return changes[0]
+}
+
+// namedTasks returns the tasks called web by state.
+func namedTasks(c *fake.Cluster) map[task.State][]*task.Task {
+	tasks := make(map[task.State][]*task.Task)
+	for _, t := range c.Manager.GetTasks() {
+		if t.Name == "web" {
+			tasks[t.State] = append(tasks[t.State], t)
+		}
+	}
+	return tasks
+}
+
+func TestDiffChangesNothing(t *testing.T) {
+	c := fake.NewCluster(1)
+
+	change := apply(t, c, taskManifest("web:1"), true)
+	if change.Action != manager.ActionCreated {
+		t.Fatalf("diff says %s, expected %s", change.Action, manager.ActionCreated)
+	}
+	if n := len(c.Manager.GetTasks()); n != 0 {
+		t.Fatalf("diff created %d tasks", n)
+	}
+
+	apply(t, c, taskManifest("web:1"), false)
+	change = apply(t, c, taskManifest("web:2"), true)
+	if change.Action != manager.ActionConfigured || len(change.Diff) != 1 {
+		t.Fatalf("diff says %s %v, expected the image to be configured", change.Action, change.Diff)
+	}
+	if n := len(c.Manager.GetTasks()); n != 1 {
+		t.Fatalf("diff left %d tasks, expected 1", n)
+	}
+}
+
+func TestApplyReplacesChangedTasks(t *testing.T) {
+	c := fake.NewCluster(1)
+	r := c.Runtimes["worker-1"]
+
+	if change := apply(t, c, taskManifest("web:1"), false); change.Action != manager.ActionCreated {
+		t.Fatalf("first apply says %s", change.Action)
+	}
+	c.Run(5, func() bool { return running(r, "web:1") == 1 })
+	if change := apply(t, c, taskManifest("web:1"), false); change.Action != manager.ActionUnchanged {
+		t.Fatalf("same manifest says %s", change.Action)
+	}
+
+	if change := apply(t, c, taskManifest("web:2"), false); change.Action != manager.ActionConfigured {
+		t.Fatalf("changed manifest says %s", change.Action)
+	}
+	// the old task still runs, but only the new one answers to the name
+	for i := 0; i < 3; i++ {
+		if change := apply(t, c, taskManifest("web:2"), false); change.Action != manager.ActionUnchanged {
+			t.Fatalf("applying again says %s", change.Action)
+		}
+	}
+
+	ok := c.Run(10, func() bool {
+		active := namedTasks(c)[task.RUNNING]
+		return len(active) == 1 && active[0].Image == "web:2" && running(r, "web:1") == 0
+	})
+	if !ok {
+		t.Fatalf("%d old and %d new tasks running", running(r, "web:1"), running(r, "web:2"))
+	}
+}
+
+func TestRejectedReplacementsKeepTheOldTask(t *testing.T) {
+	c := fake.NewCluster(1)
+	r := c.Runtimes["worker-1"]
+	apply(t, c, taskManifest("web:1"), false)
+	c.Run(5, func() bool { return len(namedTasks(c)[task.RUNNING]) == 1 })
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		review := manager.AdmissionReview{}
+		json.NewDecoder(r.Body).Decode(&review)
+		json.NewEncoder(w).Encode(manager.AdmissionResponse{UID: review.UID, Message: "no"})
+	}))
+	defer s.Close()
+	c.Manager.Webhooks = []manager.Webhook{{Name: "deny", Type: manager.WebhookValidating, URL: s.URL}}
+
+	apply(t, c, taskManifest("web:2"), false)
+	c.Run(5, func() bool { return len(namedTasks(c)[task.FAILED]) == 1 })
+	if tasks := namedTasks(c); len(tasks[task.RUNNING]) != 1 || tasks[task.RUNNING][0].Image != "web:1" || running(r, "web:1") != 1 {
+		t.Fatalf("old task was stopped for a rejected one: %v", tasks)
+	}
+	c.Manager.Webhooks = nil
+	if change := apply(t, c, taskManifest("web:1"), true); change.Action != manager.ActionUnchanged {
+		t.Fatalf("old task isn't found by its name, diff says %s", change.Action)
+	}
+}
+
+func TestApplyChecksTheQuota(t *testing.T) {
+	c := fake.NewCluster(1)
+	_, err := c.Manager.SetQuota(task.DefaultNamespace, manager.Quota{Tasks: 1, Policy: manager.QuotaReject})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Submit(task.Task{Name: "other", Image: "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Manager.Apply(task.DefaultNamespace, taskManifest("web:1"), false)
+	var overQuota *manager.QuotaError
+	if !errors.As(err, &overQuota) {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	if tasks := namedTasks(c); len(tasks) != 0 {
+		t.Fatalf("task was created over the quota: %v", tasks)
+	}
+}
+
+func TestDeleteManifestsStopsTasks(t *testing.T) {
+	c := fake.NewCluster(1)
+	r := c.Runtimes["worker-1"]
+	apply(t, c, taskManifest("web:1"), false)
+	c.Run(5, func() bool { return running(r, "web:1") == 1 })
+
+	changes, err := c.Manager.DeleteManifests(task.DefaultNamespace, taskManifest("web:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes[0].Action != manager.ActionDeleted {
+		t.Fatalf("delete says %s", changes[0].Action)
+	}
+	changes, err = c.Manager.DeleteManifests(task.DefaultNamespace, taskManifest("web:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes[0].Action != manager.ActionNotFound {
+		t.Fatalf("deleting again says %s", changes[0].Action)
+	}
+
+	if !c.Run(10, func() bool { return running(r, "web:1") == 0 }) {
+		t.Fatal("deleted task still runs")
+	}
+	if change := apply(t, c, taskManifest("web:1"), true); change.Action != manager.ActionCreated {
+		t.Fatalf("diff after delete says %s", change.Action)
+	}
+}
+
+func TestViewersCanDiff(t *testing.T) {
+	c := fake.NewCluster(1)
+	api := &manager.Api{Manager: c.Manager, Auth: &auth.Authenticator{Tokens: []auth.Token{
+		{Name: "viewer", Token: "viewer-token", Role: auth.RoleViewer},
+	}}}
+	s := httptest.NewServer(api.Handler())
+	defer s.Close()
+	body, _ := json.Marshal(taskManifest("web:1"))
+
+	post := func(endpoint string) *http.Response {
+		req, _ := http.NewRequest("POST", s.URL+"/manifests/"+endpoint, bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer viewer-token")
+		resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp := post("diff")
+	var changes []manager.Change
+	json.NewDecoder(resp.Body).Decode(&changes)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(changes) != 1 || changes[0].Action != manager.ActionCreated {
+		t.Fatalf("diff answered %d: %v", resp.StatusCode, changes)
+	}
+	resp = post("apply")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("viewer applied with status %d", resp.StatusCode)
+	}
+	if n := len(c.Manager.GetTasks()); n != 0 {
+		t.Fatalf("viewer created %d tasks", n)
+	}
+}
@@ -0,0 +1,156 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// DefaultNamespace holds everything created without a namespace, it
+// always exists and can't be deleted.
+const DefaultNamespace = task.DefaultNamespace
+
+var namespaceName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Namespace groups tasks, services, cron tasks and workflows. Names of
+// resources only need to be unique within their namespace.
+type Namespace struct {
+	ID        uuid.UUID
+	Name      string
+	CreatedAt time.Time
+	Quota     Quota
+}
+
+func (n *Namespace) Validate() error {
+	if len(n.Name) > 63 || !namespaceName.MatchString(n.Name) {
+		return fmt.Errorf("namespace name %q must be at most 63 lowercase letters, digits or '-', starting and ending with a letter or digit", n.Name)
+	}
+	return n.Quota.Validate()
+}
+
+// namespaceID derives the key of a namespace from its name, so looking one
+// up by name doesn't need a scan.
+func namespaceID(name string) uuid.UUID {
+	return uuid.NewSHA1(uuid.Nil, []byte(name))
+}
+
+// namespaceOf returns the namespace of a resource, the ones stored before
+// namespaces existed belong to the default one.
+func namespaceOf(ns string) string {
+	if ns == "" {
+		return DefaultNamespace
+	}
+	return ns
+}
+
+func (m *Manager) GetNamespaces() []*Namespace {
+	results, err := m.NamespaceDb.List()
+	if err != nil {
+		log.Printf("error getting list of namespaces: %v\n", err)
+		return nil
+	}
+	return results.([]*Namespace)
+}
+
+func (m *Manager) GetNamespace(name string) (*Namespace, error) {
+	result, err := m.NamespaceDb.Get(namespaceID(name))
+	if err != nil {
+		return nil, fmt.Errorf("namespace %s not found", name)
+	}
+	return result.(*Namespace), nil
+}
+
+func (m *Manager) AddNamespace(n Namespace) (*Namespace, error) {
+	err := n.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.GetNamespace(n.Name); err == nil {
+		return nil, fmt.Errorf("namespace %s already exists", n.Name)
+	}
+
+	n.ID = namespaceID(n.Name)
+	n.CreatedAt = time.Now().UTC()
+	err = m.NamespaceDb.Put(n.ID, &n)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// ensureDefaultNamespace creates the default namespace the first time the
+// manager starts.
+func (m *Manager) ensureDefaultNamespace() {
+	if _, err := m.GetNamespace(DefaultNamespace); err == nil {
+		return
+	}
+	_, err := m.AddNamespace(Namespace{Name: DefaultNamespace})
+	if err != nil {
+		log.Printf("failed to create the default namespace: %v\n", err)
+	}
+}
+
+// DeleteNamespace deletes everything in a namespace, stopping and removing
+// its tasks, then the namespace itself.
+func (m *Manager) DeleteNamespace(name string) error {
+	if name == DefaultNamespace {
+		return fmt.Errorf("the default namespace can't be deleted")
+	}
+	n, err := m.GetNamespace(name)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range m.GetServices() {
+		if namespaceOf(s.Namespace) == name {
+			m.DeleteService(s.ID)
+		}
+	}
+	for _, c := range m.GetCronTasks() {
+		if namespaceOf(c.Namespace) == name {
+			m.DeleteCronTask(c.ID)
+		}
+	}
+	for _, wf := range m.GetWorkflows() {
+		if namespaceOf(wf.Namespace) == name {
+			m.DeleteWorkflow(wf.ID)
+		}
+	}
+	// the tasks on workers are purged right away and every task is
+	// forgotten, SendWork drops the events of the namespace left in the
+	// queue
+	for _, t := range m.NamespaceTasks(name) {
+		if w, ok := m.TaskWorkerMap[t.ID]; ok {
+			m.purgeTask(w, t.ID.String())
+		}
+		m.forgetTask(t.ID)
+	}
+	return m.NamespaceDb.Delete(n.ID)
+}
+
+// forgetTask removes every trace of a task from the manager.
+func (m *Manager) forgetTask(id uuid.UUID) {
+	if w, ok := m.TaskWorkerMap[id]; ok {
+		m.WorkerTaskMap[w] = remove(m.WorkerTaskMap[w], id)
+		delete(m.TaskWorkerMap, id)
+	}
+	delete(m.Health, id)
+	delete(m.Lost, id)
+	delete(m.Retired, id)
+	m.TaskDb.Delete(id)
+}
+
+// NamespaceTasks returns the tasks of a namespace.
+func (m *Manager) NamespaceTasks(ns string) []*task.Task {
+	tasks := []*task.Task{}
+	for _, t := range m.GetTasks() {
+		if namespaceOf(t.Namespace) == ns {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// namespace returns the namespace a request works on, taken from the
+// /namespaces/{namespace} prefix of its path. Requests without one work
+// on the default namespace.
+func namespace(r *http.Request) string {
+	if ns := chi.URLParam(r, "namespace"); ns != "" {
+		return ns
+	}
+	return DefaultNamespace
+}
+
+// setNamespace puts the namespace of the request in a resource being
+// created. A resource that names another namespace is refused.
+func setNamespace(w http.ResponseWriter, r *http.Request, ns *string) bool {
+	if *ns != "" && *ns != namespace(r) {
+		msg := fmt.Sprintf("namespace %s of the body does not match namespace %s of the request", *ns, namespace(r))
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return false
+	}
+	*ns = namespace(r)
+	return true
+}
+
+// inNamespace tells whether a resource is in the namespace of the
+// request. Resources of other namespaces are reported as not found.
+func inNamespace(r *http.Request, ns string) bool {
+	return namespaceOf(ns) == namespace(r)
+}
+
+func (a *Api) namespaceExists(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := a.Manager.GetNamespace(namespace(r))
+		if err != nil {
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Api) CreateNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	ns := Namespace{}
+	err := decoder.Decode(&ns)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	n, err := a.Manager.AddNamespace(ns)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid namespace: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	log.Printf("Added namespace %s\n", n.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(n)
+}
+
+func (a *Api) GetNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.GetNamespaces())
+}
+
+func (a *Api) GetNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	n, _ := a.Manager.GetNamespace(namespace(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(n)
+}
+
+func (a *Api) DeleteNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteNamespace(namespace(r))
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: err.Error()})
+		return
+	}
+	log.Printf("Deleted namespace %s\n", namespace(r))
+	w.WriteHeader(204)
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/node"
+)
+
+// nodeTimeout is how long a node can stay silent before its status is
+// Unknown, a few heartbeats and polls of the manager.
+const nodeTimeout = 45 * time.Second
+
+var ErrUnknownNode = errors.New("unknown node, register first")
+
+// RegisterNode adds a worker that joined by itself to the ones the manager
+// schedules on. A worker registering again, after a restart, only has its
+// capacity and labels updated.
+func (m *Manager) RegisterNode(r node.Registration) (*node.Node, error) {
+	err := r.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := m.getNode(r.Address)
+	if n == nil {
+		n = node.NewNode(r.Address, m.workerURL(r.Address, ""), "workers")
+		m.Workers = append(m.Workers, r.Address)
+		m.WorkerTaskMap[r.Address] = []uuid.UUID{}
+		m.WorkerNodes = append(m.WorkerNodes, n)
+		log.Printf("worker %s joined at %s\n", r.Name, r.Address)
+	} else {
+		log.Printf("worker %s at %s registered again\n", r.Name, r.Address)
+	}
+
+	host, _, _ := net.SplitHostPort(r.Address)
+	n.Ip = host
+	n.Hostname = r.Name
+	n.Cores = r.Cores
+	n.Memory = r.Memory
+	n.Disk = r.Disk
+	n.Labels = r.Labels
+	n.LastSeen = time.Now().UTC()
+	m.setNodeStatus(n, node.Ready, "")
+	return n, nil
+}
+
+func (m *Manager) getNode(name string) *node.Node {
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// ValidJoinToken tells whether token is one of the join tokens.
+func (m *Manager) ValidJoinToken(token string) bool {
+	for _, t := range m.JoinTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Heartbeat records that a worker is alive. Workers the manager doesn't
+// know, after it restarted, get ErrUnknownNode and register again.
+func (m *Manager) Heartbeat(h node.Heartbeat) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := m.getNode(h.Address)
+	if n == nil {
+		return ErrUnknownNode
+	}
+	n.LastSeen = time.Now().UTC()
+	n.TaskCount = h.TaskCount
+	// a worker that can't be reached stays NotReady until the manager
+	// reaches it again
+	if n.Status != node.NotReady {
+		m.setNodeStatus(n, node.Ready, "")
+	}
+	return nil
+}
+
+// nodeSeen records that the manager reached a worker, or failed to.
+func (m *Manager) nodeSeen(worker string, err error) {
+	n := m.getNode(worker)
+	if n == nil {
+		return
+	}
+	if err != nil {
+		// a worker silent for too long stays Unknown
+		if n.Status != node.Unknown || n.LastSeen.IsZero() {
+			m.setNodeStatus(n, node.NotReady, fmt.Sprintf("manager can't reach the worker: %v", err))
+		}
+		return
+	}
+	n.LastSeen = time.Now().UTC()
+	m.setNodeStatus(n, node.Ready, "")
+}
+
+// checkNodes marks the nodes nothing was heard from for nodeTimeout as
+// Unknown.
+func (m *Manager) checkNodes(now time.Time) {
+	for _, n := range m.WorkerNodes {
+		if n.Status != node.Unknown && !n.LastSeen.IsZero() && now.Sub(n.LastSeen) > nodeTimeout {
+			m.setNodeStatus(n, node.Unknown, fmt.Sprintf("nothing heard from the worker for %s", now.Sub(n.LastSeen).Round(time.Second)))
+		}
+	}
+}
+
+func (m *Manager) setNodeStatus(n *node.Node, status string, reason string) {
+	if n.Status != status {
+		log.Printf("node %s is %s %s\n", n.Name, status, reason)
+	}
+	if status == node.Ready {
+		n.DownSince = time.Time{}
+	} else if n.DownSince.IsZero() {
+		n.DownSince = time.Now().UTC()
+	}
+	n.Status = status
+	n.Reason = reason
+}
+
+// unreachable tells whether the worker is known to be down. Workers never
+// heard from yet get the benefit of the doubt.
+func (m *Manager) unreachable(worker string) bool {
+	n := m.getNode(worker)
+	if n == nil {
+		return false
+	}
+	return n.Status == node.NotReady || (n.Status == node.Unknown && !n.LastSeen.IsZero())
+}
@@ -0,0 +1,44 @@
+package manager_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/node"
+)
+
+func workerNode(c *fake.Cluster, name string) *node.Node {
+	for _, n := range c.Manager.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+func TestListedWorkersStayAliveThroughHeartbeats(t *testing.T) {
+	c := fake.NewCluster(2)
+	c.Step()
+
+	// only the heartbeats tell the manager about the workers from now on
+	for _, n := range c.Manager.WorkerNodes {
+		n.LastSeen = time.Now().Add(-time.Hour)
+	}
+	c.StopWorker("worker-2")
+	c.Heartbeats()
+	c.Manager.CheckNodes(time.Now())
+
+	if n := workerNode(c, "worker-1"); n.Status != node.Ready {
+		t.Fatalf("worker sending heartbeats is %s, expected it ready", n.Status)
+	}
+	if n := workerNode(c, "worker-2"); n.Status != node.Unknown {
+		t.Fatalf("silent worker is %s, expected it unknown", n.Status)
+	}
+
+	c.StartWorker("worker-2")
+	c.Heartbeats()
+	if n := workerNode(c, "worker-2"); time.Since(n.LastSeen) > time.Minute {
+		t.Fatalf("worker back at %v wasn't seen", n.LastSeen)
+	}
+}
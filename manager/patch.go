@@ -0,0 +1,244 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is one operation of a JSON patch (RFC 6902). The add,
+// remove, replace, move, copy and test operations are supported.
+type PatchOperation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// ApplyPatch applies the operations in order to a JSON document. Appending
+// to an array that is null creates it, Go encodes empty slices as null.
+func ApplyPatch(doc []byte, patch []PatchOperation) ([]byte, error) {
+	var root interface{}
+	err := json.Unmarshal(doc, &root)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range patch {
+		root, err = op.apply(root)
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s): %v", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+func (op PatchOperation) apply(root interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return addPath(root, path, op.Value)
+	case "remove":
+		root, _, err := removePath(root, path)
+		return root, err
+	case "replace":
+		root, _, err := removePath(root, path)
+		if err != nil {
+			return nil, err
+		}
+		return addPath(root, path, op.Value)
+	case "move":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		// a value can't be moved into one of its own children
+		if len(from) < len(path) && slices.Equal(from, path[:len(from)]) {
+			return nil, fmt.Errorf("can't move %s into itself", op.From)
+		}
+		root, value, err := removePath(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return addPath(root, path, value)
+	case "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getPath(root, from)
+		if err != nil {
+			return nil, err
+		}
+		// the copy must not share maps or slices with the original
+		data, _ := json.Marshal(value)
+		var clone interface{}
+		json.Unmarshal(data, &clone)
+		return addPath(root, path, clone)
+	case "test":
+		value, err := getPath(root, path)
+		if err != nil {
+			return nil, err
+		}
+		// compare through json so numbers have the same type on both sides
+		data, _ := json.Marshal(op.Value)
+		var expected interface{}
+		json.Unmarshal(data, &expected)
+		if !reflect.DeepEqual(value, expected) {
+			return nil, fmt.Errorf("test failed, value is %v", value)
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > length || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func getPath(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("%q not found", token)
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("%q not found", token)
+		}
+	}
+	return node, nil
+}
+
+// addPath returns node with value added at path. Containers are updated in
+// place but arrays can grow, so the caller stores the returned node.
+func addPath(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+	last := len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if last {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("%q not found", token)
+		}
+		child, err := addPath(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		if last && token == "-" {
+			return append(n, value), nil
+		}
+		i, err := arrayIndex(token, len(n))
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		if i == len(n) {
+			return nil, fmt.Errorf("invalid array index %q", token)
+		}
+		child, err := addPath(n[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	case nil:
+		if last && (token == "-" || token == "0") {
+			return []interface{}{value}, nil
+		}
+	}
+	return nil, fmt.Errorf("%q not found", token)
+}
+
+// removePath returns node without the value at path, and that value.
+func removePath(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, node, nil
+	}
+	token := path[0]
+	last := len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%q not found", token)
+		}
+		if last {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := removePath(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if last {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		child, removed, err := removePath(n[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = child
+		return n, removed, nil
+	}
+	return nil, nil, fmt.Errorf("%q not found", token)
+}
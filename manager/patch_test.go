@@ -0,0 +1,234 @@
+package manager_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/manager"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch []manager.PatchOperation
+		want  string
+		err   bool
+	}{
+		{
+			name:  "add a field",
+			doc:   `{"a":1}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/b", Value: 2}},
+			want:  `{"a":1,"b":2}`,
+		},
+		{
+			name:  "add replaces an existing field",
+			doc:   `{"a":1}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/a", Value: 2}},
+			want:  `{"a":2}`,
+		},
+		{
+			name:  "add inserts at an array index",
+			doc:   `{"a":[1,3]}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/a/1", Value: 2}},
+			want:  `{"a":[1,2,3]}`,
+		},
+		{
+			name:  "add at the length of an array appends",
+			doc:   `{"a":[1]}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/a/1", Value: 2}},
+			want:  `{"a":[1,2]}`,
+		},
+		{
+			name:  "add past the end of an array",
+			doc:   `{"a":[1]}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/a/2", Value: 2}},
+			err:   true,
+		},
+		{
+			name:  "add to the end of an array",
+			doc:   `{"a":[1]}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/a/-", Value: 2}},
+			want:  `{"a":[1,2]}`,
+		},
+		{
+			name:  "add to the end of a null array",
+			doc:   `{"a":null}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/a/-", Value: 1}},
+			want:  `{"a":[1]}`,
+		},
+		{
+			name:  "add under a missing parent",
+			doc:   `{}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/a/b", Value: 1}},
+			err:   true,
+		},
+		{
+			name:  "add with a leading zero index",
+			doc:   `{"a":[1,2]}`,
+			patch: []manager.PatchOperation{{Op: "add", Path: "/a/01", Value: 3}},
+			err:   true,
+		},
+		{
+			name:  "remove a field",
+			doc:   `{"a":1,"b":2}`,
+			patch: []manager.PatchOperation{{Op: "remove", Path: "/a"}},
+			want:  `{"b":2}`,
+		},
+		{
+			name:  "remove an array element",
+			doc:   `{"a":[1,2,3]}`,
+			patch: []manager.PatchOperation{{Op: "remove", Path: "/a/1"}},
+			want:  `{"a":[1,3]}`,
+		},
+		{
+			name:  "remove a missing field",
+			doc:   `{}`,
+			patch: []manager.PatchOperation{{Op: "remove", Path: "/a"}},
+			err:   true,
+		},
+		{
+			name:  "remove with -",
+			doc:   `{"a":[1]}`,
+			patch: []manager.PatchOperation{{Op: "remove", Path: "/a/-"}},
+			err:   true,
+		},
+		{
+			name:  "replace a nested field",
+			doc:   `{"a":{"b":1}}`,
+			patch: []manager.PatchOperation{{Op: "replace", Path: "/a/b", Value: "x"}},
+			want:  `{"a":{"b":"x"}}`,
+		},
+		{
+			name:  "replace an array element",
+			doc:   `{"a":[1,2,3]}`,
+			patch: []manager.PatchOperation{{Op: "replace", Path: "/a/1", Value: 5}},
+			want:  `{"a":[1,5,3]}`,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"a":1}`,
+			patch: []manager.PatchOperation{{Op: "replace", Path: "", Value: map[string]int{"b": 2}}},
+			want:  `{"b":2}`,
+		},
+		{
+			name:  "replace a missing field",
+			doc:   `{}`,
+			patch: []manager.PatchOperation{{Op: "replace", Path: "/a", Value: 1}},
+			err:   true,
+		},
+		{
+			name:  "move a field",
+			doc:   `{"a":{"b":1},"c":{}}`,
+			patch: []manager.PatchOperation{{Op: "move", From: "/a/b", Path: "/c/d"}},
+			want:  `{"a":{},"c":{"d":1}}`,
+		},
+		{
+			name:  "move within an array",
+			doc:   `{"a":[1,2,3]}`,
+			patch: []manager.PatchOperation{{Op: "move", From: "/a/0", Path: "/a/-"}},
+			want:  `{"a":[2,3,1]}`,
+		},
+		{
+			name:  "move into its own child",
+			doc:   `{"a":{"b":{}}}`,
+			patch: []manager.PatchOperation{{Op: "move", From: "/a", Path: "/a/b/c"}},
+			err:   true,
+		},
+		{
+			name:  "move to a sibling with the same prefix",
+			doc:   `{"a":1}`,
+			patch: []manager.PatchOperation{{Op: "move", From: "/a", Path: "/ab"}},
+			want:  `{"ab":1}`,
+		},
+		{
+			name:  "copy a field",
+			doc:   `{"a":{"b":1}}`,
+			patch: []manager.PatchOperation{{Op: "copy", From: "/a", Path: "/c"}},
+			want:  `{"a":{"b":1},"c":{"b":1}}`,
+		},
+		{
+			name: "copies don't share their children",
+			doc:  `{"a":{"b":1}}`,
+			patch: []manager.PatchOperation{
+				{Op: "copy", From: "/a", Path: "/c"},
+				{Op: "replace", Path: "/c/b", Value: 2},
+			},
+			want: `{"a":{"b":1},"c":{"b":2}}`,
+		},
+		{
+			name:  "copy a missing field",
+			doc:   `{}`,
+			patch: []manager.PatchOperation{{Op: "copy", From: "/a", Path: "/b"}},
+			err:   true,
+		},
+		{
+			name: "test a value",
+			doc:  `{"a":[1,{"b":"x"}]}`,
+			patch: []manager.PatchOperation{
+				{Op: "test", Path: "/a/1", Value: map[string]string{"b": "x"}},
+				{Op: "test", Path: "/a/0", Value: 1},
+			},
+			want: `{"a":[1,{"b":"x"}]}`,
+		},
+		{
+			name:  "test a different value",
+			doc:   `{"a":1}`,
+			patch: []manager.PatchOperation{{Op: "test", Path: "/a", Value: 2}},
+			err:   true,
+		},
+		{
+			name: "a failed test stops the patch",
+			doc:  `{"a":1}`,
+			patch: []manager.PatchOperation{
+				{Op: "test", Path: "/a", Value: 2},
+				{Op: "remove", Path: "/a"},
+			},
+			err: true,
+		},
+		{
+			name: "escaped pointers",
+			doc:  `{"a/b":1,"c~d":2}`,
+			patch: []manager.PatchOperation{
+				{Op: "replace", Path: "/a~1b", Value: 3},
+				{Op: "remove", Path: "/c~0d"},
+				{Op: "add", Path: "/e~01", Value: 4},
+			},
+			want: `{"a/b":3,"e~1":4}`,
+		},
+		{
+			name:  "pointer without a leading slash",
+			doc:   `{"a":1}`,
+			patch: []manager.PatchOperation{{Op: "remove", Path: "a"}},
+			err:   true,
+		},
+		{
+			name:  "unknown operation",
+			doc:   `{"a":1}`,
+			patch: []manager.PatchOperation{{Op: "merge", Path: "/a"}},
+			err:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := manager.ApplyPatch([]byte(tt.doc), tt.patch)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("patch applied as %s, expected an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotDoc, wantDoc interface{}
+			json.Unmarshal(got, &gotDoc)
+			json.Unmarshal([]byte(tt.want), &wantDoc)
+			if !reflect.DeepEqual(gotDoc, wantDoc) {
+				t.Fatalf("got %s, expected %s", got, tt.want)
+			}
+		})
+	}
+}
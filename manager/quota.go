@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// What happens to a task that would take its namespace over quota.
+// Rejected tasks fail to be created, queued ones are kept PENDING until
+// enough of the namespace's tasks finish.
+const (
+	QuotaReject = "Reject"
+	QuotaQueue  = "Queue"
+)
+
+// Quota limits what the tasks of a namespace can ask for in total, a zero
+// limit means no limit.
+type Quota struct {
+	Cpu    float64
+	Memory int64
+	Disk   int64
+	Tasks  int
+	Policy string
+}
+
+// ResourceUsage adds up the resources asked for by a set of tasks.
+type ResourceUsage struct {
+	Cpu    float64
+	Memory int64
+	Disk   int64
+	Tasks  int
+}
+
+// QuotaStatus is the quota of a namespace next to what its tasks use.
+// Used counts the scheduled and running tasks, failed ones about to be
+// restarted included, Pending the ones waiting for a worker or for room in
+// the quota.
+type QuotaStatus struct {
+	Namespace string
+	Limits    Quota
+	Used      ResourceUsage
+	Pending   ResourceUsage
+}
+
+// QuotaError is returned when a task doesn't fit in the quota of its
+// namespace.
+type QuotaError struct {
+	Namespace string
+	Exceeded  []string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("exceeded quota of namespace %s: %s", e.Namespace, strings.Join(e.Exceeded, ", "))
+}
+
+func (q *Quota) Validate() error {
+	if q.Cpu < 0 || q.Memory < 0 || q.Disk < 0 || q.Tasks < 0 {
+		return fmt.Errorf("quota limits can't be negative")
+	}
+	switch q.Policy {
+	case "", QuotaReject, QuotaQueue:
+	default:
+		return fmt.Errorf("unknown quota policy %q", q.Policy)
+	}
+	return nil
+}
+
+func (u ResourceUsage) add(t *task.Task) ResourceUsage {
+	u.Cpu += t.Cpu
+	u.Memory += t.Memory
+	u.Disk += t.Disk
+	u.Tasks++
+	return u
+}
+
+// exceeded lists the limits u goes over, as "resource used/limit".
+func (q *Quota) exceeded(u ResourceUsage) []string {
+	var over []string
+	if q.Cpu > 0 && u.Cpu > q.Cpu {
+		over = append(over, fmt.Sprintf("cpu %g/%g", u.Cpu, q.Cpu))
+	}
+	if q.Memory > 0 && u.Memory > q.Memory {
+		over = append(over, fmt.Sprintf("memory %d/%d", u.Memory, q.Memory))
+	}
+	if q.Disk > 0 && u.Disk > q.Disk {
+		over = append(over, fmt.Sprintf("disk %d/%d", u.Disk, q.Disk))
+	}
+	if q.Tasks > 0 && u.Tasks > q.Tasks {
+		over = append(over, fmt.Sprintf("tasks %d/%d", u.Tasks, q.Tasks))
+	}
+	return over
+}
+
+// usage adds up the tasks of a namespace in the given states, but for the
+// task except. Workflow tasks don't count until they are released, failed
+// tasks the manager will restart count as running.
+func (m *Manager) usage(ns string, except uuid.UUID, states ...task.State) ResourceUsage {
+	held := m.heldTasks()
+	u := ResourceUsage{}
+	for _, t := range m.NamespaceTasks(ns) {
+		if t.ID == except || held[t.ID] {
+			continue
+		}
+		state := t.State
+		if state == task.FAILED && !gaveUp(t) && !m.Retired[t.ID] {
+			state = task.RUNNING
+		}
+		for _, s := range states {
+			if state == s {
+				u = u.add(t)
+				break
+			}
+		}
+	}
+	return u
+}
+
+// heldTasks returns the workflow tasks not released yet, they are stored
+// PENDING from the start but wait for their dependencies.
+func (m *Manager) heldTasks() map[uuid.UUID]bool {
+	held := make(map[uuid.UUID]bool)
+	for _, wf := range m.GetWorkflows() {
+		for _, wt := range wf.Tasks {
+			if !wt.Released {
+				held[wt.TaskID] = true
+			}
+		}
+	}
+	return held
+}
+
+// checkQuota is run when a task is submitted. With the Reject policy the
+// task has to fit next to every active task of its namespace, pending ones
+// included. With the Queue policy it only has to fit on its own, SendWork
+// holds it back until there is room.
+func (m *Manager) checkQuota(t task.Task) error {
+	n, err := m.GetNamespace(namespaceOf(t.Namespace))
+	if err != nil {
+		return err
+	}
+
+	u := ResourceUsage{}
+	if n.Quota.Policy != QuotaQueue {
+		u = m.usage(n.Name, t.ID, task.PENDING, task.SCHEDULED, task.RUNNING)
+	}
+	if over := n.Quota.exceeded(u.add(&t)); len(over) > 0 {
+		return &QuotaError{Namespace: n.Name, Exceeded: over}
+	}
+	return nil
+}
+
+// fitsQuota tells whether a pending task can be sent to a worker without
+// taking its namespace over quota.
+func (m *Manager) fitsQuota(t task.Task) bool {
+	n, err := m.GetNamespace(namespaceOf(t.Namespace))
+	if err != nil {
+		return true
+	}
+	u := m.usage(n.Name, t.ID, task.SCHEDULED, task.RUNNING)
+	return len(n.Quota.exceeded(u.add(&t))) == 0
+}
+
+func (m *Manager) SetQuota(ns string, q Quota) (*Namespace, error) {
+	n, err := m.GetNamespace(ns)
+	if err != nil {
+		return nil, err
+	}
+	err = q.Validate()
+	if err != nil {
+		return nil, err
+	}
+	n.Quota = q
+	err = m.NamespaceDb.Put(n.ID, n)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (m *Manager) GetQuotaStatus(ns string) (*QuotaStatus, error) {
+	n, err := m.GetNamespace(ns)
+	if err != nil {
+		return nil, err
+	}
+	return &QuotaStatus{
+		Namespace: n.Name,
+		Limits:    n.Quota,
+		Used:      m.usage(n.Name, uuid.Nil, task.SCHEDULED, task.RUNNING),
+		Pending:   m.usage(n.Name, uuid.Nil, task.PENDING),
+	}, nil
+}
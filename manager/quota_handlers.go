@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+func (a *Api) GetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := a.Manager.GetQuotaStatus(namespace(r))
+	if err != nil {
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(status)
+}
+
+func (a *Api) PutQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	quota := Quota{}
+	err := decoder.Decode(&quota)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	n, err := a.Manager.SetQuota(namespace(r), quota)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid quota: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	log.Printf("Set quota of namespace %s\n", n.Name)
+	a.GetQuotaHandler(w, r)
+}
@@ -0,0 +1,137 @@
+package manager_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+func newQuotaCluster(t *testing.T, q manager.Quota) *fake.Cluster {
+	c := fake.NewCluster(2)
+	_, err := c.Manager.AddNamespace(manager.Namespace{Name: "team", Quota: q})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestQuotaRejectsTasksOverTheLimit(t *testing.T) {
+	c := newQuotaCluster(t, manager.Quota{Tasks: 1, Policy: manager.QuotaReject})
+
+	_, err := c.Submit(task.Task{Name: "a", Image: "nginx", Namespace: "team"})
+	if err != nil {
+		t.Fatalf("first task: %v", err)
+	}
+	_, err = c.Submit(task.Task{Name: "b", Image: "nginx", Namespace: "team"})
+	var overQuota *manager.QuotaError
+	if !errors.As(err, &overQuota) {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+
+	// other namespaces are not affected
+	_, err = c.Submit(task.Task{Name: "b", Image: "nginx"})
+	if err != nil {
+		t.Fatalf("task in the default namespace: %v", err)
+	}
+}
+
+func TestQuotaQueueHoldsTasksUntilThereIsRoom(t *testing.T) {
+	c := newQuotaCluster(t, manager.Quota{Tasks: 1, Policy: manager.QuotaQueue})
+
+	first, err := c.Submit(task.Task{Name: "a", Image: "nginx", Namespace: "team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Submit(task.Task{Name: "b", Image: "nginx", Namespace: "team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Run(5, func() bool { return false })
+	if s := c.Task(first.Task.ID).State; s != task.RUNNING {
+		t.Fatalf("first task is %v, expected it running", s)
+	}
+	if s := c.Task(second.Task.ID).State; s != task.PENDING {
+		t.Fatalf("second task is %v, expected it held back", s)
+	}
+
+	err = c.Runtimes[c.WorkerOf(first.Task.ID)].Exit(c.Task(first.Task.ID).ContainerID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := c.Run(10, func() bool { return c.Task(second.Task.ID).State == task.RUNNING })
+	if !ok {
+		t.Fatalf("second task is %v once the first one exited", c.Task(second.Task.ID).State)
+	}
+}
+
+func TestQuotaCountsWorkflowTasksOnceReleased(t *testing.T) {
+	c := newQuotaCluster(t, manager.Quota{Tasks: 2, Policy: manager.QuotaReject})
+
+	wf, err := c.Manager.AddWorkflow(manager.Workflow{
+		Name:      "etl",
+		Namespace: "team",
+		Tasks: []manager.WorkflowTask{
+			{Name: "extract", Task: task.Task{Image: "job"}},
+			{Name: "load", DependsOn: []string{"extract"}, Task: task.Task{Image: "job"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := c.Run(20, func() bool {
+		finishJobs(c)
+		w, _ := c.Manager.GetWorkflow(wf.ID)
+		return w.Status != manager.WorkflowRunning
+	})
+	w, _ := c.Manager.GetWorkflow(wf.ID)
+	if !ok || w.Status != manager.WorkflowSucceeded {
+		for _, tk := range c.Manager.WorkflowTasks(w) {
+			t.Logf("%s: %v %s", tk.Name, tk.State, tk.TerminationReason)
+		}
+		t.Fatalf("workflow is %s, expected it to succeed", w.Status)
+	}
+}
+
+// finishJobs makes every running container of the job image exit with 0.
+func finishJobs(c *fake.Cluster) {
+	for _, r := range c.Runtimes {
+		for _, ct := range r.Containers() {
+			if ct.Config.Image == "job" && ct.Status == "running" {
+				r.Exit(ct.ID, 0)
+			}
+		}
+	}
+}
+
+func TestQuotaKeepsRoomForFailedTasksToRestart(t *testing.T) {
+	c := newQuotaCluster(t, manager.Quota{Tasks: 1, Policy: manager.QuotaReject})
+	a := web("web:1")
+	a.Namespace = "team"
+	first, err := c.Submit(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := runningOn(t, c, first.Task.ID)
+
+	err = c.Runtimes[w].Exit(c.Task(first.Task.ID).ContainerID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Workers[w].Step()
+	c.Manager.RefreshTasks()
+	if s := c.Task(first.Task.ID).State; s != task.FAILED {
+		t.Fatalf("first task is %v, expected it failed", s)
+	}
+
+	_, err = c.Submit(task.Task{Name: "b", Image: "nginx", Namespace: "team"})
+	var overQuota *manager.QuotaError
+	if !errors.As(err, &overQuota) {
+		t.Fatalf("expected a quota error while the first task waits for its restart, got %v", err)
+	}
+	runningOn(t, c, first.Task.ID)
+}
@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// defaultRescheduleAfter leaves a worker a few minutes to come back, a
+// reboot shouldn't move everything it runs.
+const defaultRescheduleAfter = 5 * time.Minute
+
+// rescheduleLostTasks takes the tasks off the workers that have been down
+// for longer than RescheduleAfter. They are marked lost and, unless they
+// belong to a service that already replaced them, queued again so the
+// scheduler puts them on a healthy worker.
+func (m *Manager) rescheduleLostTasks(now time.Time) {
+	lost := false
+	for _, n := range m.WorkerNodes {
+		if !m.unreachable(n.Name) || n.DownSince.IsZero() || now.Sub(n.DownSince) < m.RescheduleAfter {
+			continue
+		}
+		for _, id := range m.WorkerTaskMap[n.Name] {
+			result, err := m.TaskDb.Get(id)
+			if err != nil {
+				continue
+			}
+			t := result.(*task.Task)
+			if t.State != task.SCHEDULED && t.State != task.RUNNING && (t.State != task.FAILED || gaveUp(t)) {
+				continue
+			}
+			m.loseTask(n.Name, t)
+			lost = true
+		}
+	}
+	if lost {
+		m.updateNodeAllocations()
+	}
+}
+
+func (m *Manager) loseTask(worker string, t *task.Task) {
+	log.Printf("task %v is lost, worker %s has been down for more than %s\n", t.ID, worker, m.RescheduleAfter)
+	m.WorkerTaskMap[worker] = remove(m.WorkerTaskMap[worker], t.ID)
+	delete(m.TaskWorkerMap, t.ID)
+	delete(m.Health, t.ID)
+	if m.Lost == nil {
+		m.Lost = make(map[uuid.UUID][]string)
+	}
+	if !m.lostCopy(t.ID, worker) {
+		m.Lost[t.ID] = append(m.Lost[t.ID], worker)
+	}
+
+	t.TerminationReason = task.ReasonLost
+	t.ContainerID = ""
+	t.HostPorts = nil
+	if t.ServiceID != uuid.Nil {
+		// the service started a replacement when the worker went down
+		t.State = task.FAILED
+		t.FinishTime = time.Now().UTC()
+		m.TaskDb.Put(t.ID, t)
+		return
+	}
+
+	t.State = task.PENDING
+	m.TaskDb.Put(t.ID, t)
+	m.Pending.Enqueue(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.RUNNING,
+		Timestamp: time.Now(),
+		Task:      *t,
+	})
+}
+
+// lostCopy tells whether worker may still run a copy of a lost task.
+func (m *Manager) lostCopy(id uuid.UUID, worker string) bool {
+	for _, w := range m.Lost[id] {
+		if w == worker {
+			return true
+		}
+	}
+	return false
+}
+
+// stopLostTask stops the copy of a lost task a worker runs after coming
+// back, so it doesn't run next to the one that replaced it. The worker is
+// forgotten once it reports the copy stopped.
+func (m *Manager) stopLostTask(worker string, t *task.Task) {
+	if t.State == task.PENDING || t.State == task.SCHEDULED || t.State == task.RUNNING {
+		log.Printf("worker %s is back with lost task %v, stopping it\n", worker, t.ID)
+		m.stopTask(worker, t.ID.String())
+		return
+	}
+
+	var workers []string
+	for _, w := range m.Lost[t.ID] {
+		if w != worker {
+			workers = append(workers, w)
+		}
+	}
+	if len(workers) == 0 {
+		delete(m.Lost, t.ID)
+	} else {
+		m.Lost[t.ID] = workers
+	}
+}
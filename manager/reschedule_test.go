@@ -0,0 +1,145 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// runningOn steps the cluster until the task runs on a worker other than
+// the ones given, and returns that worker.
+func runningOn(t *testing.T, c *fake.Cluster, id uuid.UUID, not ...string) string {
+	t.Helper()
+	ok := c.Run(10, func() bool {
+		w := c.WorkerOf(id)
+		if w == "" || c.Task(id).State != task.RUNNING {
+			return false
+		}
+		for _, n := range not {
+			if w == n {
+				return false
+			}
+		}
+		return true
+	})
+	if !ok {
+		t.Fatalf("task is %v on %q, expected it running elsewhere than %v", c.Task(id).State, c.WorkerOf(id), not)
+	}
+	return c.WorkerOf(id)
+}
+
+// running counts the running containers of an image on a worker.
+func running(r *fake.Runtime, image string) int {
+	n := 0
+	for _, ct := range r.Containers() {
+		if ct.Config.Image == image && ct.Status == "running" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLostTasksWaitForTheGracePeriod(t *testing.T) {
+	c := fake.NewCluster(2)
+	te, err := c.Submit(task.Task{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := runningOn(t, c, te.Task.ID)
+
+	c.StopWorker(first)
+	c.Run(5, func() bool { return false })
+	if w := c.WorkerOf(te.Task.ID); w != first {
+		t.Fatalf("task moved to %q before the grace period", w)
+	}
+
+	c.Manager.RescheduleAfter = 0
+	runningOn(t, c, te.Task.ID, first)
+}
+
+func TestStaleCopiesOfLostTasksAreStopped(t *testing.T) {
+	c := fake.NewCluster(3)
+	c.Manager.RescheduleAfter = 0
+	te, err := c.Submit(task.Task{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := te.Task.ID
+
+	a := runningOn(t, c, id)
+	c.StopWorker(a)
+	b := runningOn(t, c, id, a)
+	c.StopWorker(b)
+	last := runningOn(t, c, id, a, b)
+	container := c.Task(id).ContainerID
+
+	c.StartWorker(a)
+	c.StartWorker(b)
+	ok := c.Run(10, func() bool {
+		return running(c.Runtimes[a], "nginx") == 0 && running(c.Runtimes[b], "nginx") == 0
+	})
+	if !ok {
+		t.Fatal("the copies left on the workers that came back are still running")
+	}
+
+	c.Run(5, func() bool { return false })
+	got := c.Task(id)
+	if got.State != task.RUNNING || c.WorkerOf(id) != last || got.ContainerID != container {
+		t.Fatalf("task is %v on %q with container %q, expected it running on %q with %q",
+			got.State, c.WorkerOf(id), got.ContainerID, last, container)
+	}
+	if n := len(c.Manager.Lost); n != 0 {
+		t.Fatalf("%d lost tasks still tracked once their copies stopped", n)
+	}
+}
+
+func TestLostServiceReplicasAreReplaced(t *testing.T) {
+	c := fake.NewCluster(2)
+	c.Manager.RescheduleAfter = 0
+	s, err := c.Manager.AddService(manager.Service{
+		Name:     "web",
+		Replicas: 1,
+		Template: task.Task{Image: "nginx"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lost uuid.UUID
+	ok := c.Run(10, func() bool {
+		for _, tk := range c.Manager.ServiceTasks(s) {
+			if tk.State == task.RUNNING {
+				lost = tk.ID
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		t.Fatal("the service never got a running replica")
+	}
+
+	c.StopWorker(c.WorkerOf(lost))
+	ok = c.Run(10, func() bool {
+		tk := c.Task(lost)
+		return tk.State == task.FAILED && tk.TerminationReason == task.ReasonLost
+	})
+	if !ok {
+		tk := c.Task(lost)
+		t.Fatalf("lost replica is %v (%q), expected it failed as lost", tk.State, tk.TerminationReason)
+	}
+
+	c.Run(5, func() bool { return false })
+	replicas := 0
+	for _, tk := range c.Manager.ServiceTasks(s) {
+		if tk.State == task.RUNNING {
+			replicas++
+		}
+	}
+	if replicas != 1 {
+		t.Fatalf("%d replicas running, expected 1", replicas)
+	}
+}
@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// Phases of canary and blue/green rollouts.
+const (
+	PhaseCanary   = "Canary"
+	PhasePromoted = "Promoted"
+	PhaseFlipped  = "Flipped"
+)
+
+const (
+	defaultCanaryPercent    = 10
+	defaultAnalysisWindow   = 5 * time.Minute
+	defaultSuccessThreshold = 0.95
+)
+
+func (u UpdateStrategy) analysisWindow() (time.Duration, error) {
+	if u.AnalysisWindow == "" {
+		return defaultAnalysisWindow, nil
+	}
+	return time.ParseDuration(u.AnalysisWindow)
+}
+
+// canaries returns how many tasks of the new revision are tried out, at
+// least one and never more than the replicas.
+func (u UpdateStrategy) canaries(replicas int) int {
+	percent := u.CanaryPercent
+	if percent == 0 {
+		percent = defaultCanaryPercent
+	}
+	n := int(math.Ceil(float64(replicas*percent) / 100))
+	return min(max(n, 1), replicas)
+}
+
+func (u UpdateStrategy) successThreshold() float64 {
+	if u.SuccessThreshold == 0 {
+		return defaultSuccessThreshold
+	}
+	return u.SuccessThreshold
+}
+
+// analyzing tells whether the service is trying a new revision on its
+// canaries and hasn't decided yet.
+func (s *Service) analyzing() bool {
+	return s.Strategy.Type == StrategyCanary &&
+		s.Rollout.State == RolloutProgressing &&
+		s.Rollout.Phase != PhasePromoted
+}
+
+// canaryService runs the canaries next to the old tasks for the analysis
+// window. Once it is over the revision is promoted if enough of the health
+// checks of the canaries passed, the rest of the tasks are then replaced
+// like in a rolling update. Otherwise the rollout is aborted.
+func (m *Manager) canaryService(s *Service, current, old []*task.Task) {
+	n := s.Strategy.canaries(s.Replicas)
+	for i := len(current); i < n; i++ {
+		if m.startServiceTask(s, s.current()) != nil {
+			break
+		}
+	}
+	if s.Rollout.Phase != PhaseCanary {
+		s.Rollout.Phase = PhaseCanary
+		s.Rollout.AnalysisStart = time.Now()
+		s.Rollout.Message = fmt.Sprintf("analyzing %d canaries of revision %d", n, s.Revision)
+	}
+
+	checks, passed := 0, 0
+	for _, t := range current {
+		if gaveUp(t) {
+			m.abortRollout(s, fmt.Sprintf("canary %s failed", t.ID))
+			return
+		}
+		if r, ok := m.Health[t.ID]; ok {
+			checks += r.Checks
+			passed += r.Passed
+		}
+	}
+
+	window, _ := s.Strategy.analysisWindow()
+	if time.Since(s.Rollout.AnalysisStart) < window || checks == 0 {
+		return
+	}
+
+	rate := float64(passed) / float64(checks)
+	if rate < s.Strategy.successThreshold() {
+		m.abortRollout(s, fmt.Sprintf("canaries passed %.0f%% of their health checks", rate*100))
+		return
+	}
+
+	s.Rollout.Phase = PhasePromoted
+	s.Rollout.Message = fmt.Sprintf("canaries passed %.0f%% of their health checks, revision %d promoted", rate*100, s.Revision)
+	log.Printf("service %s: %s\n", s.Name, s.Rollout.Message)
+	m.rollService(s, current, old)
+}
+
+// abortRollout goes back to the previous revision, its tasks were left
+// running so the ones of the aborted revision are simply stopped.
+func (m *Manager) abortRollout(s *Service, reason string) {
+	if len(s.History) < 2 {
+		s.Rollout = RolloutStatus{State: RolloutPaused, Message: reason + ", rollout paused"}
+		return
+	}
+	s.activate(len(s.History) - 2)
+	s.Rollout = RolloutStatus{
+		State:   RolloutAborted,
+		Message: fmt.Sprintf("%s, back to revision %d", reason, s.Revision),
+	}
+	log.Printf("service %s: rollout aborted, %s\n", s.Name, s.Rollout.Message)
+}
+
+// blueGreenService brings up a full set of tasks of the new revision next
+// to the old ones and only stops the old set once every new task is
+// healthy. Failures are handled like in a rolling update.
+func (m *Manager) blueGreenService(s *Service, current, old []*task.Task) {
+	for i := len(current); i < s.Replicas; i++ {
+		if m.startServiceTask(s, s.current()) != nil {
+			break
+		}
+	}
+	if len(current) < s.Replicas {
+		return
+	}
+	for _, t := range current {
+		if !m.ready(t) {
+			return
+		}
+	}
+
+	if s.Rollout.Phase != PhaseFlipped {
+		s.Rollout.Phase = PhaseFlipped
+		log.Printf("service %s: revision %d is healthy, stopping the previous tasks\n", s.Name, s.Revision)
+	}
+	for _, t := range old {
+		if m.stopServiceTask(t) {
+			s.Tasks = remove(s.Tasks, t.ID)
+		}
+	}
+}
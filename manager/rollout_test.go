@@ -0,0 +1,123 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+)
+
+func canary(window string) manager.UpdateStrategy {
+	return manager.UpdateStrategy{
+		Type:           manager.StrategyCanary,
+		CanaryPercent:  25,
+		AnalysisWindow: window,
+	}
+}
+
+func TestCanariesArePromotedAfterTheAnalysis(t *testing.T) {
+	c := fake.NewCluster(2)
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 4, Template: web("web:1")})
+	settle(t, c, s, "web:1", 4)
+
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{Replicas: 4, Template: web("web:2"), Strategy: canary("1h")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run(10, func() bool { return false })
+	got := replicas(c, s)
+	if got["web:2"] != 1 || got["web:1"] != 4 {
+		t.Fatalf("service runs %v during the analysis, expected 1 canary next to 4 old tasks", got)
+	}
+	if s, _ := c.Manager.GetService(s.ID); s.Rollout.Phase != manager.PhaseCanary {
+		t.Fatalf("rollout is in phase %q, expected %q", s.Rollout.Phase, manager.PhaseCanary)
+	}
+
+	// end the analysis window
+	_, err = c.Manager.UpdateService(s.ID, manager.Service{Replicas: 4, Template: web("web:2"), Strategy: canary("1ns")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = settle(t, c, s, "web:2", 4)
+	if s.Rollout.State != manager.RolloutComplete || s.Revision != 2 {
+		t.Fatalf("rollout is %s at revision %d, expected revision 2 rolled out", s.Rollout.State, s.Revision)
+	}
+}
+
+func TestFailingCanariesAbortTheRollout(t *testing.T) {
+	c := fake.NewCluster(2)
+	unhealthy(c, "web:2")
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 4, Template: web("web:1")})
+	settle(t, c, s, "web:1", 4)
+
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{Replicas: 4, Template: web("web:2"), Strategy: canary("1ns")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := c.Run(30, func() bool {
+		got := replicas(c, s)
+		if got["web:1"] < 4 {
+			t.Fatalf("service runs %v, old tasks were stopped during the analysis", got)
+		}
+		s, _ := c.Manager.GetService(s.ID)
+		return s.Rollout.State == manager.RolloutAborted
+	})
+	if !ok {
+		t.Fatal("rollout of unhealthy canaries was not aborted")
+	}
+	s = settle(t, c, s, "web:1", 4)
+	if s.Revision != 1 {
+		t.Fatalf("service is at revision %d, expected it back to 1", s.Revision)
+	}
+}
+
+func TestBlueGreenFlipsOnceTheNewSetIsHealthy(t *testing.T) {
+	c := fake.NewCluster(2)
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 2, Template: web("web:1")})
+	settle(t, c, s, "web:1", 2)
+
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{
+		Replicas: 2,
+		Template: web("web:2"),
+		Strategy: manager.UpdateStrategy{Type: manager.StrategyBlueGreen},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	both := false
+	ok := c.Run(30, func() bool {
+		got := replicas(c, s)
+		if got["web:1"] < 2 && got["web:2"] < 2 {
+			t.Fatalf("service runs %v, the old set was stopped before the new one was up", got)
+		}
+		both = both || got["web:1"] == 2 && got["web:2"] == 2
+		s, _ := c.Manager.GetService(s.ID)
+		return got["web:2"] == 2 && got["web:1"] == 0 && s.Rollout.State == manager.RolloutComplete
+	})
+	if !ok {
+		t.Fatalf("service runs %v, expected revision 2 rolled out", replicas(c, s))
+	}
+	if !both {
+		t.Fatal("the new set never ran next to the old one")
+	}
+}
+
+func TestBlueGreenKeepsTheOldSetWhenTheNewOneIsUnhealthy(t *testing.T) {
+	c := fake.NewCluster(2)
+	unhealthy(c, "web:2")
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 2, Template: web("web:1")})
+	settle(t, c, s, "web:1", 2)
+
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{
+		Replicas: 2,
+		Template: web("web:2"),
+		Strategy: manager.UpdateStrategy{Type: manager.StrategyBlueGreen, FailureAction: manager.FailureRollback},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = settle(t, c, s, "web:1", 2)
+	if s.Rollout.State != manager.RolloutRolledBack {
+		t.Fatalf("rollout is %s, expected it rolled back", s.Rollout.State)
+	}
+}
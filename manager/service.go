@@ -0,0 +1,545 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// What a rollout does when a task of the new revision fails its health
+// checks.
+const (
+	FailurePause    = "pause"
+	FailureRollback = "rollback"
+)
+
+// States of the rollout of the current revision of a service.
+const (
+	RolloutComplete    = "Complete"
+	RolloutProgressing = "Progressing"
+	RolloutPaused      = "Paused"
+	RolloutRolledBack  = "RolledBack"
+	RolloutAborted     = "Aborted"
+)
+
+// Ways of rolling out a new revision. Rolling replaces tasks in batches,
+// canary tries the revision on a few tasks before going on and blue/green
+// brings up a whole new set before stopping the old one.
+const (
+	StrategyRolling   = "rolling"
+	StrategyCanary    = "canary"
+	StrategyBlueGreen = "bluegreen"
+)
+
+const revisionHistoryLimit = 10
+
+// UpdateStrategy controls how tasks are replaced when the template of a
+// service changes. MaxSurge is how many tasks can run over the replicas
+// and MaxUnavailable how many can be missing while the update goes on.
+// The canary fields are only used by the canary strategy.
+type UpdateStrategy struct {
+	Type             string
+	MaxSurge         int
+	MaxUnavailable   int
+	FailureAction    string
+	CanaryPercent    int
+	AnalysisWindow   string
+	SuccessThreshold float64
+}
+
+// limits returns the surge and unavailability allowed, a rollout that
+// allows neither would never make progress so it surges by one.
+func (u UpdateStrategy) limits() (int, int) {
+	if u.MaxSurge == 0 && u.MaxUnavailable == 0 {
+		return 1, 0
+	}
+	return u.MaxSurge, u.MaxUnavailable
+}
+
+type ServiceRevision struct {
+	Revision  int
+	Template  task.Task
+	CreatedAt time.Time
+}
+
+type RolloutStatus struct {
+	State         string
+	Message       string
+	Phase         string
+	AnalysisStart time.Time
+}
+
+// Service keeps Replicas copies of the task described by Template running,
+// replacing the ones that fail or get lost with their worker. Every change
+// to the template is a new revision, History holds them in the order they
+// became current.
+type Service struct {
+	ID        uuid.UUID
+	Name      string
+	Namespace string
+	Replicas  int
+	Template  task.Task
+	Strategy  UpdateStrategy
+	Revision  int
+	History   []ServiceRevision
+	Rollout   RolloutStatus
+	Tasks     []uuid.UUID
+}
+
+func (s *Service) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("service name is required")
+	}
+	if s.Replicas < 0 {
+		return fmt.Errorf("replicas can't be negative")
+	}
+	if errs := s.Template.Validate(); len(errs) > 0 {
+		return errs.Prefix("Template")
+	}
+	if s.Template.IsJob() {
+		return fmt.Errorf("services can't run jobs")
+	}
+	if s.Strategy.MaxSurge < 0 || s.Strategy.MaxUnavailable < 0 {
+		return fmt.Errorf("maxSurge and maxUnavailable can't be negative")
+	}
+	switch s.Strategy.FailureAction {
+	case "", FailurePause, FailureRollback:
+	default:
+		return fmt.Errorf("unknown failure action %q", s.Strategy.FailureAction)
+	}
+	switch s.Strategy.Type {
+	case "", StrategyRolling, StrategyCanary, StrategyBlueGreen:
+	default:
+		return fmt.Errorf("unknown update strategy %q", s.Strategy.Type)
+	}
+	if s.Strategy.CanaryPercent < 0 || s.Strategy.CanaryPercent > 100 {
+		return fmt.Errorf("canary percent must be between 0 and 100")
+	}
+	if s.Strategy.SuccessThreshold < 0 || s.Strategy.SuccessThreshold > 1 {
+		return fmt.Errorf("success threshold must be between 0 and 1")
+	}
+	if _, err := s.Strategy.analysisWindow(); err != nil {
+		return fmt.Errorf("invalid analysis window: %v", err)
+	}
+	return nil
+}
+
+func (s *Service) newRevision(template task.Task) {
+	next := 1
+	for _, r := range s.History {
+		next = max(next, r.Revision+1)
+	}
+	s.History = append(s.History, ServiceRevision{
+		Revision:  next,
+		Template:  template,
+		CreatedAt: time.Now(),
+	})
+	if len(s.History) > revisionHistoryLimit {
+		s.History = s.History[len(s.History)-revisionHistoryLimit:]
+	}
+	s.Revision = next
+	s.Template = template
+}
+
+// activate makes an older revision the current one again. Its tasks that
+// are still around count as up to date.
+func (s *Service) activate(i int) {
+	r := s.History[i]
+	s.History = append(append(s.History[:i:i], s.History[i+1:]...), r)
+	s.Revision = r.Revision
+	s.Template = r.Template
+}
+
+func (s *Service) current() ServiceRevision {
+	return s.History[len(s.History)-1]
+}
+
+// lastGood is the revision that was current before the one rolling out,
+// or the current one if there was none.
+func (s *Service) lastGood() ServiceRevision {
+	if len(s.History) < 2 {
+		return s.current()
+	}
+	return s.History[len(s.History)-2]
+}
+
+func (m *Manager) GetServices() []*Service {
+	results, err := m.ServiceDb.List()
+	if err != nil {
+		log.Printf("error getting list of services: %v\n", err)
+		return nil
+	}
+	return results.([]*Service)
+}
+
+func (m *Manager) GetService(id uuid.UUID) (*Service, error) {
+	result, err := m.ServiceDb.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Service), nil
+}
+
+func (m *Manager) GetServiceByName(ns string, name string) (*Service, bool) {
+	for _, s := range m.GetServices() {
+		if s.Name == name && namespaceOf(s.Namespace) == ns {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func (m *Manager) AddService(s Service) (*Service, error) {
+	err := s.Validate()
+	if err != nil {
+		return nil, err
+	}
+	s.Namespace = namespaceOf(s.Namespace)
+	if _, err := m.GetNamespace(s.Namespace); err != nil {
+		return nil, err
+	}
+	if _, ok := m.GetServiceByName(s.Namespace, s.Name); ok {
+		return nil, fmt.Errorf("service %s already exists in namespace %s", s.Name, s.Namespace)
+	}
+
+	s.ID = uuid.New()
+	s.Tasks = nil
+	s.History = nil
+	s.Template.Kind = task.KindService
+	s.newRevision(s.Template)
+	s.Rollout = RolloutStatus{State: RolloutComplete}
+	err = m.ServiceDb.Put(s.ID, &s)
+	if err != nil {
+		return nil, err
+	}
+	m.reconcileService(&s)
+	return &s, nil
+}
+
+// UpdateService changes the replica count, the strategy and the template
+// of a service. A new template starts a rollout that replaces the running
+// tasks following the update strategy.
+func (m *Manager) UpdateService(id uuid.UUID, spec Service) (*Service, error) {
+	s, err := m.GetService(id)
+	if err != nil {
+		return nil, err
+	}
+	spec.Name = s.Name
+	spec.Namespace = s.Namespace
+	err = spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Replicas = spec.Replicas
+	s.Strategy = spec.Strategy
+	spec.Template.Kind = task.KindService
+	if !reflect.DeepEqual(spec.Template, s.Template) {
+		s.newRevision(spec.Template)
+		s.Rollout = RolloutStatus{
+			State:   RolloutProgressing,
+			Message: fmt.Sprintf("rolling out revision %d", s.Revision),
+		}
+	}
+	err = m.ServiceDb.Put(s.ID, s)
+	if err != nil {
+		return nil, err
+	}
+	m.reconcileService(s)
+	return s, nil
+}
+
+// UndoRollout goes back to the revision that was current before the
+// current one.
+func (m *Manager) UndoRollout(id uuid.UUID) (*Service, error) {
+	s, err := m.GetService(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.History) < 2 {
+		return nil, fmt.Errorf("service %s has no previous revision", s.Name)
+	}
+
+	s.activate(len(s.History) - 2)
+	s.Rollout = RolloutStatus{
+		State:   RolloutProgressing,
+		Message: fmt.Sprintf("rolling back to revision %d", s.Revision),
+	}
+	err = m.ServiceDb.Put(s.ID, s)
+	if err != nil {
+		return nil, err
+	}
+	m.reconcileService(s)
+	return s, nil
+}
+
+// DeleteService stops every task of a service before forgetting it, the
+// ones that didn't start yet never do.
+func (m *Manager) DeleteService(id uuid.UUID) error {
+	s, err := m.GetService(id)
+	if err != nil {
+		return err
+	}
+	for _, t := range m.ServiceTasks(s) {
+		m.cancelTask(t)
+	}
+	return m.ServiceDb.Delete(id)
+}
+
+// ServiceTasks returns the tasks owned by a service. The ones still
+// waiting in the pending queue are reported as PENDING.
+func (m *Manager) ServiceTasks(s *Service) []*task.Task {
+	tasks := []*task.Task{}
+	for _, id := range s.Tasks {
+		result, err := m.TaskDb.Get(id)
+		if err != nil {
+			tasks = append(tasks, &task.Task{ID: id, ServiceID: s.ID, State: task.PENDING})
+			continue
+		}
+		tasks = append(tasks, result.(*task.Task))
+	}
+	return tasks
+}
+
+func (m *Manager) ProcessServices() {
+	for {
+		log.Println("Reconciling services")
+		m.mu.Lock()
+		m.reconcileServices()
+		m.mu.Unlock()
+		m.flush()
+		time.Sleep(10 * time.Second)
+	}
+}
+
+func (m *Manager) reconcileServices() {
+	for _, s := range m.GetServices() {
+		m.reconcileService(s)
+	}
+}
+
+// isLive tells whether a task counts towards the replicas of its service:
+// it is on its way to run or running on a worker that still answers, or
+// it failed but the health checks are going to restart it.
+func (m *Manager) isLive(t *task.Task) bool {
+	if m.unreachable(m.TaskWorkerMap[t.ID]) {
+		return false
+	}
+	switch t.State {
+	case task.PENDING, task.SCHEDULED, task.RUNNING:
+		return true
+	case task.FAILED:
+		return !gaveUp(t)
+	}
+	return false
+}
+
+// ready tells whether a task is running and passed its last health check.
+func (m *Manager) ready(t *task.Task) bool {
+	r, ok := m.Health[t.ID]
+	return t.State == task.RUNNING && ok && r.Healthy
+}
+
+// unhealthy tells whether a task failed, or failed its last health check.
+func (m *Manager) unhealthy(t *task.Task) bool {
+	r, ok := m.Health[t.ID]
+	return t.State == task.FAILED || (ok && !r.Healthy)
+}
+
+// reconcileService starts or stops tasks until the number of live ones
+// matches the replicas of the service, replacing the tasks of older
+// revisions while a rollout is in progress.
+func (m *Manager) reconcileService(s *Service) {
+	var live []*task.Task
+	var owned []uuid.UUID
+	var failed *task.Task
+	for _, t := range m.ServiceTasks(s) {
+		if t.Revision == s.Revision && m.unhealthy(t) {
+			failed = t
+		}
+		switch {
+		case m.isLive(t):
+			live = append(live, t)
+			owned = append(owned, t.ID)
+		case m.unreachable(m.TaskWorkerMap[t.ID]):
+			// keep an eye on it, if the worker comes back it counts again
+			// and the extra replica is stopped
+			owned = append(owned, t.ID)
+		}
+	}
+	s.Tasks = owned
+
+	// a canary under analysis is judged on its success rate instead
+	if failed != nil && s.Rollout.State == RolloutProgressing && !s.analyzing() {
+		m.failRollout(s, failed)
+	}
+
+	var current, old []*task.Task
+	for _, t := range live {
+		if t.Revision == s.Revision {
+			current = append(current, t)
+		} else {
+			old = append(old, t)
+		}
+	}
+
+	switch {
+	case s.Rollout.State == RolloutPaused:
+		// hold on to what is running and fill the gaps with the last
+		// revision known to work
+		for i := len(live); i < s.Replicas; i++ {
+			if m.startServiceTask(s, s.lastGood()) != nil {
+				break
+			}
+		}
+	case len(old) == 0:
+		m.scaleService(s, current, s.current())
+		if s.Rollout.State == RolloutProgressing {
+			s.Rollout = RolloutStatus{
+				State:   RolloutComplete,
+				Message: fmt.Sprintf("revision %d rolled out", s.Revision),
+			}
+		}
+	case s.analyzing():
+		m.canaryService(s, current, old)
+	case s.Strategy.Type == StrategyBlueGreen && s.Rollout.State == RolloutProgressing:
+		m.blueGreenService(s, current, old)
+	default:
+		m.rollService(s, current, old)
+	}
+
+	m.ServiceDb.Put(s.ID, s)
+}
+
+func (m *Manager) failRollout(s *Service, t *task.Task) {
+	msg := fmt.Sprintf("task %s of revision %d failed its health checks", t.ID, s.Revision)
+	if s.Strategy.FailureAction == FailureRollback && len(s.History) > 1 {
+		s.activate(len(s.History) - 2)
+		s.Rollout = RolloutStatus{
+			State:   RolloutRolledBack,
+			Message: fmt.Sprintf("%s, rolled back to revision %d", msg, s.Revision),
+		}
+	} else {
+		s.Rollout = RolloutStatus{State: RolloutPaused, Message: msg + ", rollout paused"}
+	}
+	log.Printf("service %s: %s\n", s.Name, s.Rollout.Message)
+}
+
+// scaleService starts tasks of the given revision or stops the newest
+// ones until there are as many live tasks as replicas.
+func (m *Manager) scaleService(s *Service, live []*task.Task, r ServiceRevision) {
+	for i := len(live); i < s.Replicas; i++ {
+		if m.startServiceTask(s, r) != nil {
+			break
+		}
+	}
+
+	if len(live) > s.Replicas {
+		// stop the newest tasks first, the oldest ones are more likely to
+		// be warmed up and healthy
+		extra := len(live) - s.Replicas
+		for i := len(live) - 1; i >= 0 && extra > 0; i-- {
+			if m.stopServiceTask(live[i]) {
+				s.Tasks = remove(s.Tasks, live[i].ID)
+				extra--
+			}
+		}
+	}
+}
+
+// rollService moves a rollout one batch forward. New tasks are started as
+// long as the surge allows it and old ones are stopped as long as enough
+// tasks are left serving, new tasks only count once they are healthy.
+func (m *Manager) rollService(s *Service, current, old []*task.Task) {
+	surge, unavailable := s.Strategy.limits()
+
+	start := min(s.Replicas-len(current), s.Replicas+surge-len(current)-len(old))
+	for i := 0; i < start; i++ {
+		if m.startServiceTask(s, s.current()) != nil {
+			break
+		}
+	}
+
+	available := 0
+	for _, t := range current {
+		if m.ready(t) {
+			available++
+		}
+	}
+	for _, t := range old {
+		if t.State == task.RUNNING {
+			available++
+		}
+	}
+
+	// the oldest revisions go first
+	sort.SliceStable(old, func(i, j int) bool {
+		return old[i].Revision > old[j].Revision
+	})
+	stop := available - (s.Replicas - unavailable)
+	for i := len(old) - 1; i >= 0 && stop > 0; i-- {
+		if m.stopServiceTask(old[i]) {
+			s.Tasks = remove(s.Tasks, old[i].ID)
+			stop--
+		}
+	}
+}
+
+// startServiceTask adds a task of revision r to the service. It fails
+// when the task is not admitted.
+func (m *Manager) startServiceTask(s *Service, r ServiceRevision) error {
+	t := r.Template
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%s", s.Name, t.ID.String()[:8])
+	t.State = task.PENDING
+	t.ServiceID = s.ID
+	t.Namespace = namespaceOf(s.Namespace)
+	t.Revision = r.Revision
+	t.RestartCount = 0
+
+	err := m.submitTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.RUNNING,
+		Timestamp: time.Now(),
+		Task:      t,
+	})
+	if err != nil {
+		return err
+	}
+	s.Tasks = append(s.Tasks, t.ID)
+	log.Printf("service %s started task %s of revision %d\n", s.Name, t.ID, r.Revision)
+	return nil
+}
+
+// stopServiceTask asks for a task to be stopped. Only running tasks can
+// be stopped, the others are left to settle first.
+func (m *Manager) stopServiceTask(t *task.Task) bool {
+	if t.State != task.RUNNING {
+		return false
+	}
+	taskCopy := *t
+	taskCopy.State = task.COMPLETED
+	m.AddTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.COMPLETED,
+		Timestamp: time.Now(),
+		Task:      taskCopy,
+	})
+	log.Printf("stopping task %s of service %s\n", t.ID, t.ServiceID)
+	return true
+}
+
+func remove(ids []uuid.UUID, id uuid.UUID) []uuid.UUID {
+	var result []uuid.UUID
+	for _, i := range ids {
+		if i != id {
+			result = append(result, i)
+		}
+	}
+	return result
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func decodeService(w http.ResponseWriter, r *http.Request) (Service, bool) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	service := Service{}
+	err := decoder.Decode(&service)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return service, false
+	}
+	return service, true
+}
+
+func (a *Api) CreateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	service, ok := decodeService(w, r)
+	if !ok || !setNamespace(w, r, &service.Namespace) || !allowHostAccess(w, r, service.Template) {
+		return
+	}
+
+	s, err := a.Manager.AddService(service)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid service: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	log.Printf("Added service %s (%v)\n", s.Name, s.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) GetServicesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	services := []*Service{}
+	for _, s := range a.Manager.GetServices() {
+		if inNamespace(r, s.Namespace) {
+			services = append(services, s)
+		}
+	}
+	json.NewEncoder(w).Encode(services)
+}
+
+func (a *Api) service(w http.ResponseWriter, r *http.Request) (*Service, bool) {
+	serviceID := chi.URLParam(r, "serviceID")
+	id, err := uuid.Parse(serviceID)
+	if err != nil {
+		msg := fmt.Sprintf("invalid service id %s: %v", serviceID, err)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return nil, false
+	}
+
+	s, err := a.Manager.GetService(id)
+	if err == nil && !inNamespace(r, s.Namespace) {
+		err = fmt.Errorf("service %v not found in namespace %s", id, namespace(r))
+	}
+	if err != nil {
+		log.Printf("No service with id %v found\n", id)
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return nil, false
+	}
+	return s, true
+}
+
+func (a *Api) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := a.service(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) UpdateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := a.service(w, r)
+	if !ok {
+		return
+	}
+	spec, ok := decodeService(w, r)
+	if !ok || !setNamespace(w, r, &spec.Namespace) || !allowHostAccess(w, r, spec.Template) {
+		return
+	}
+
+	s, err := a.Manager.UpdateService(s.ID, spec)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid service: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	log.Printf("Updated service %s (%v)\n", s.Name, s.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) GetServiceTasksHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := a.service(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.ServiceTasks(s))
+}
+
+func (a *Api) DeleteServiceHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := a.service(w, r)
+	if !ok {
+		return
+	}
+	err := a.Manager.DeleteService(s.ID)
+	if err != nil {
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: err.Error()})
+		return
+	}
+	log.Printf("Deleted service %s (%v)\n", s.Name, s.ID)
+	w.WriteHeader(204)
+}
+
+func (a *Api) UndoRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := a.service(w, r)
+	if !ok {
+		return
+	}
+
+	s, err := a.Manager.UndoRollout(s.ID)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to undo rollout: %v", err)
+		log.Println(msg)
+		w.WriteHeader(409)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 409, Message: msg})
+		return
+	}
+
+	log.Printf("Rolled service %s (%v) back to revision %d\n", s.Name, s.ID, s.Revision)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(s)
+}
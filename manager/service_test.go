@@ -0,0 +1,256 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// web is the template of a service that answers its health checks.
+func web(image string) task.Task {
+	return task.Task{
+		Image:        image,
+		ExposedPorts: nat.PortSet{"80/tcp": {}},
+		HealthCheck:  "/health",
+	}
+}
+
+// replicas counts the running tasks of a service by image.
+func replicas(c *fake.Cluster, s *manager.Service) map[string]int {
+	s, _ = c.Manager.GetService(s.ID)
+	count := make(map[string]int)
+	for _, t := range c.Manager.ServiceTasks(s) {
+		if t.State == task.RUNNING {
+			count[t.Image]++
+		}
+	}
+	return count
+}
+
+func addService(t *testing.T, c *fake.Cluster, s manager.Service) *manager.Service {
+	t.Helper()
+	added, err := c.Manager.AddService(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return added
+}
+
+func TestServicesRunTheirReplicas(t *testing.T) {
+	c := fake.NewCluster(2)
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 3, Template: web("web:1")})
+
+	if !c.Run(10, func() bool { return replicas(c, s)["web:1"] == 3 }) {
+		t.Fatalf("service runs %v, expected 3 replicas", replicas(c, s))
+	}
+	c.Run(5, func() bool { return false })
+	if got := replicas(c, s)["web:1"]; got != 3 {
+		t.Fatalf("service settled on %d replicas, expected 3", got)
+	}
+
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{Replicas: 1, Template: web("web:1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Run(10, func() bool { return replicas(c, s)["web:1"] == 1 }) {
+		t.Fatalf("service runs %v once scaled down, expected 1 replica", replicas(c, s))
+	}
+}
+
+func TestServicesReplaceReplicasOfDeadWorkers(t *testing.T) {
+	c := fake.NewCluster(2)
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 2, Template: web("web:1")})
+	if !c.Run(10, func() bool { return replicas(c, s)["web:1"] == 2 }) {
+		t.Fatalf("service runs %v, expected 2 replicas", replicas(c, s))
+	}
+
+	s, _ = c.Manager.GetService(s.ID)
+	dead := c.WorkerOf(s.Tasks[0])
+	alive := "worker-1"
+	if dead == alive {
+		alive = "worker-2"
+	}
+
+	c.StopWorker(dead)
+	ok := c.Run(10, func() bool {
+		n := 0
+		for _, ct := range c.Runtimes[alive].Containers() {
+			if ct.Status == "running" {
+				n++
+			}
+		}
+		return n == 2
+	})
+	if !ok {
+		t.Fatal("the replicas of the dead worker were not replaced on the other one")
+	}
+}
+
+// settle steps the cluster until a service runs only the given image and
+// its rollout is over.
+func settle(t *testing.T, c *fake.Cluster, s *manager.Service, image string, want int) *manager.Service {
+	t.Helper()
+	ok := c.Run(30, func() bool {
+		got := replicas(c, s)
+		s, _ := c.Manager.GetService(s.ID)
+		return len(got) == 1 && got[image] == want && s.Rollout.State != manager.RolloutProgressing
+	})
+	s, _ = c.Manager.GetService(s.ID)
+	if !ok {
+		t.Fatalf("service runs %v with rollout %s, expected %d replicas of %s", replicas(c, s), s.Rollout.State, want, image)
+	}
+	return s
+}
+
+// unhealthy makes the containers of image fail their health checks.
+func unhealthy(c *fake.Cluster, image string) {
+	for _, r := range c.Runtimes {
+		r.SetBehavior(image, fake.Behavior{Unhealthy: true})
+	}
+}
+
+func TestRollingUpdatesReplaceEveryTask(t *testing.T) {
+	c := fake.NewCluster(2)
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 3, Template: web("web:1")})
+	settle(t, c, s, "web:1", 3)
+
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{
+		Replicas: 3,
+		Template: web("web:2"),
+		Strategy: manager.UpdateStrategy{MaxSurge: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := c.Run(30, func() bool {
+		got := replicas(c, s)
+		if got["web:1"]+got["web:2"] > 4 {
+			t.Fatalf("service runs %v, more than the surge allows", got)
+		}
+		s, _ := c.Manager.GetService(s.ID)
+		return got["web:2"] == 3 && got["web:1"] == 0 && s.Rollout.State == manager.RolloutComplete
+	})
+	if !ok {
+		t.Fatalf("service runs %v, expected revision 2 rolled out", replicas(c, s))
+	}
+	if s, _ := c.Manager.GetService(s.ID); s.Revision != 2 {
+		t.Fatalf("service is at revision %d, expected 2", s.Revision)
+	}
+}
+
+func TestFailedRolloutsRollBack(t *testing.T) {
+	c := fake.NewCluster(2)
+	unhealthy(c, "web:2")
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 2, Template: web("web:1")})
+	settle(t, c, s, "web:1", 2)
+
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{
+		Replicas: 2,
+		Template: web("web:2"),
+		Strategy: manager.UpdateStrategy{FailureAction: manager.FailureRollback},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = settle(t, c, s, "web:1", 2)
+	if s.Rollout.State != manager.RolloutRolledBack || s.Revision != 1 {
+		t.Fatalf("rollout is %s at revision %d, expected it rolled back to 1", s.Rollout.State, s.Revision)
+	}
+}
+
+func TestFailedRolloutsPause(t *testing.T) {
+	c := fake.NewCluster(2)
+	unhealthy(c, "web:2")
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 2, Template: web("web:1")})
+	settle(t, c, s, "web:1", 2)
+
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{
+		Replicas: 2,
+		Template: web("web:2"),
+		Strategy: manager.UpdateStrategy{FailureAction: manager.FailurePause},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := c.Run(30, func() bool {
+		s, _ := c.Manager.GetService(s.ID)
+		return s.Rollout.State == manager.RolloutPaused
+	})
+	if !ok {
+		t.Fatal("rollout of an unhealthy revision was not paused")
+	}
+	c.Run(5, func() bool { return false })
+	if got := replicas(c, s)["web:1"]; got != 2 {
+		t.Fatalf("paused rollout left %d tasks of the last good revision, expected 2", got)
+	}
+}
+
+func TestUndoRolloutGoesBackToThePreviousRevision(t *testing.T) {
+	c := fake.NewCluster(2)
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 2, Template: web("web:1")})
+	settle(t, c, s, "web:1", 2)
+	_, err := c.Manager.UpdateService(s.ID, manager.Service{Replicas: 2, Template: web("web:2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settle(t, c, s, "web:2", 2)
+
+	_, err = c.Manager.UndoRollout(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = settle(t, c, s, "web:1", 2)
+	if s.Revision != 1 || s.Rollout.State != manager.RolloutComplete {
+		t.Fatalf("rollout is %s at revision %d, expected revision 1 rolled out", s.Rollout.State, s.Revision)
+	}
+}
+
+func TestDeletedServicesStopScheduledReplicas(t *testing.T) {
+	c := fake.NewCluster(2)
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 2, Template: web("web:1")})
+	// the replicas are sent to the workers, which didn't start them yet
+	c.Manager.Step()
+	for _, rt := range c.Manager.ServiceTasks(s) {
+		if rt.State != task.SCHEDULED {
+			t.Fatalf("replica is %v, expected it scheduled", rt.State)
+		}
+	}
+
+	if err := c.Manager.DeleteService(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(5, func() bool { return false })
+	for name, r := range c.Runtimes {
+		if n := running(r, "web:1"); n != 0 {
+			t.Fatalf("%s runs %d replicas of the deleted service", name, n)
+		}
+	}
+	for _, rt := range c.Manager.GetTasks() {
+		if rt.State != task.COMPLETED {
+			t.Fatalf("replica %v is %v, expected it completed", rt.ID, rt.State)
+		}
+	}
+}
+
+func TestDeletedServicesDontRestartFailedReplicas(t *testing.T) {
+	c := fake.NewCluster(1)
+	s := addService(t, c, manager.Service{Name: "web", Replicas: 1, Template: web("web:1")})
+	settle(t, c, s, "web:1", 1)
+
+	id := c.Manager.ServiceTasks(s)[0].ID
+	if err := c.Runtimes["worker-1"].Crash(c.Task(id).ContainerID); err != nil {
+		t.Fatal(err)
+	}
+	// the worker notices, the manager learns it once the service is gone
+	c.Workers["worker-1"].Step()
+	if err := c.Manager.DeleteService(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(5, func() bool { return false })
+	if n := running(c.Runtimes["worker-1"], "web:1"); n != 0 {
+		t.Fatalf("%d failed replicas of the deleted service were restarted", n)
+	}
+}
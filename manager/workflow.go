@@ -0,0 +1,318 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// What happens to the tasks downstream of a task that failed for good.
+const (
+	OnFailureSkip = "Skip"
+	OnFailureFail = "Fail"
+)
+
+const (
+	WorkflowRunning   = "Running"
+	WorkflowSucceeded = "Succeeded"
+	WorkflowFailed    = "Failed"
+)
+
+// Workflow is a set of tasks where each one can depend on others by name.
+// A task is only sent to a worker once everything it depends on completed.
+type Workflow struct {
+	ID        uuid.UUID
+	Name      string
+	Namespace string
+	OnFailure string
+	Status    string
+	Tasks     []WorkflowTask
+	StartTime time.Time
+}
+
+type WorkflowTask struct {
+	Name      string
+	DependsOn []string
+	Task      task.Task
+	TaskID    uuid.UUID
+	Released  bool
+}
+
+func (wf *Workflow) Validate() error {
+	if wf.Name == "" {
+		return fmt.Errorf("workflow name is required")
+	}
+	switch wf.OnFailure {
+	case OnFailureSkip, OnFailureFail:
+	default:
+		return fmt.Errorf("unknown failure policy %q", wf.OnFailure)
+	}
+	if len(wf.Tasks) == 0 {
+		return fmt.Errorf("workflow %s has no tasks", wf.Name)
+	}
+
+	deps := make(map[string][]string)
+	for _, t := range wf.Tasks {
+		if t.Name == "" {
+			return fmt.Errorf("every workflow task needs a name")
+		}
+		if errs := t.Task.Validate(); len(errs) > 0 {
+			return fmt.Errorf("task %s: %w", t.Name, errs)
+		}
+		if _, ok := deps[t.Name]; ok {
+			return fmt.Errorf("task name %s is used more than once", t.Name)
+		}
+		deps[t.Name] = t.DependsOn
+	}
+	for name, upstream := range deps {
+		for _, u := range upstream {
+			if _, ok := deps[u]; !ok {
+				return fmt.Errorf("task %s depends on unknown task %s", name, u)
+			}
+		}
+	}
+
+	// depth first search, a task found again while its own dependencies
+	// are being visited closes a cycle
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %v", append(path, name))
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, u := range deps[name] {
+			err := visit(u, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+	for _, t := range wf.Tasks {
+		err := visit(t.Name, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddWorkflow stores a workflow and creates its tasks in the PENDING
+// state. Tasks without dependencies are released on the next pass.
+func (m *Manager) AddWorkflow(wf Workflow) (*Workflow, error) {
+	if wf.OnFailure == "" {
+		wf.OnFailure = OnFailureSkip
+	}
+	err := wf.Validate()
+	if err != nil {
+		return nil, err
+	}
+	wf.Namespace = namespaceOf(wf.Namespace)
+	if _, err := m.GetNamespace(wf.Namespace); err != nil {
+		return nil, err
+	}
+	// the names of the tasks of a workflow come from its name
+	for _, other := range m.GetWorkflows() {
+		if other.Name == wf.Name && namespaceOf(other.Namespace) == wf.Namespace && other.Status == WorkflowRunning {
+			return nil, fmt.Errorf("workflow %s is already running in namespace %s", wf.Name, wf.Namespace)
+		}
+	}
+
+	wf.ID = uuid.New()
+	wf.Status = WorkflowRunning
+	wf.StartTime = time.Now().UTC()
+	for i := range wf.Tasks {
+		wt := &wf.Tasks[i]
+		t := wt.Task
+		t.ID = uuid.New()
+		t.Name = fmt.Sprintf("%s-%s", wf.Name, wt.Name)
+		t.Namespace = wf.Namespace
+		t.State = task.PENDING
+		if t.Kind == "" {
+			t.Kind = task.KindJob
+		}
+		wt.Task = t
+		wt.TaskID = t.ID
+		wt.Released = false
+		m.TaskDb.Put(t.ID, &t)
+	}
+
+	err = m.WorkflowDb.Put(wf.ID, &wf)
+	if err != nil {
+		return nil, err
+	}
+	m.advanceWorkflow(&wf)
+	return &wf, nil
+}
+
+func (m *Manager) GetWorkflows() []*Workflow {
+	results, err := m.WorkflowDb.List()
+	if err != nil {
+		log.Printf("error getting list of workflows: %v\n", err)
+		return nil
+	}
+	return results.([]*Workflow)
+}
+
+func (m *Manager) GetWorkflow(id uuid.UUID) (*Workflow, error) {
+	result, err := m.WorkflowDb.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Workflow), nil
+}
+
+// WorkflowTasks returns the current state of the tasks of a workflow.
+func (m *Manager) WorkflowTasks(wf *Workflow) []*task.Task {
+	tasks := []*task.Task{}
+	for _, wt := range wf.Tasks {
+		result, err := m.TaskDb.Get(wt.TaskID)
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, result.(*task.Task))
+	}
+	return tasks
+}
+
+// DeleteWorkflow forgets a workflow. Tasks not released yet are skipped,
+// the ones already running are left alone.
+func (m *Manager) DeleteWorkflow(id uuid.UUID) error {
+	wf, err := m.GetWorkflow(id)
+	if err != nil {
+		return err
+	}
+	for _, wt := range wf.Tasks {
+		if !wt.Released {
+			m.finishWorkflowTask(wt.TaskID, task.SKIPPED, "")
+		}
+	}
+	return m.WorkflowDb.Delete(id)
+}
+
+func (m *Manager) ProcessWorkflows() {
+	for {
+		log.Println("Checking workflows")
+		m.mu.Lock()
+		m.advanceWorkflows()
+		m.mu.Unlock()
+		m.flush()
+		time.Sleep(10 * time.Second)
+	}
+}
+
+func (m *Manager) advanceWorkflows() {
+	for _, wf := range m.GetWorkflows() {
+		if wf.Status != WorkflowRunning {
+			continue
+		}
+		m.advanceWorkflow(wf)
+	}
+}
+
+// advanceWorkflow releases the tasks whose dependencies all completed and
+// skips or fails the ones that depend on a task that failed for good.
+func (m *Manager) advanceWorkflow(wf *Workflow) {
+	states := make(map[string]*task.Task)
+	for _, wt := range wf.Tasks {
+		result, err := m.TaskDb.Get(wt.TaskID)
+		if err != nil {
+			// released but not picked from the pending queue yet
+			states[wt.Name] = &wt.Task
+			continue
+		}
+		states[wt.Name] = result.(*task.Task)
+	}
+
+	// keep going until nothing changes so a failure is propagated all
+	// the way down in a single pass
+	for changed := true; changed; {
+		changed = false
+		for i := range wf.Tasks {
+			wt := &wf.Tasks[i]
+			if wt.Released || states[wt.Name].State != task.PENDING {
+				continue
+			}
+
+			ready, broken := true, false
+			for _, u := range wt.DependsOn {
+				upstream := states[u]
+				if upstream.State != task.COMPLETED {
+					ready = false
+				}
+				if gaveUp(upstream) || upstream.State == task.SKIPPED {
+					broken = true
+				}
+			}
+
+			switch {
+			case broken && wf.OnFailure == OnFailureFail:
+				states[wt.Name] = m.finishWorkflowTask(wt.TaskID, task.FAILED, task.ReasonUpstreamFailed)
+				changed = true
+			case broken:
+				states[wt.Name] = m.finishWorkflowTask(wt.TaskID, task.SKIPPED, "")
+				changed = true
+			case ready:
+				err := m.submitTask(task.TaskEvent{
+					ID:        uuid.New(),
+					State:     task.RUNNING,
+					Timestamp: time.Now(),
+					Task:      *states[wt.Name],
+				})
+				if err != nil {
+					states[wt.Name] = m.finishWorkflowTask(wt.TaskID, task.FAILED, task.ReasonRejected)
+					changed = true
+					continue
+				}
+				wt.Released = true
+				log.Printf("workflow %s released task %s\n", wf.Name, wt.Name)
+			}
+		}
+	}
+
+	wf.Status = workflowStatus(wf, states)
+	m.WorkflowDb.Put(wf.ID, wf)
+}
+
+func (m *Manager) finishWorkflowTask(id uuid.UUID, state task.State, reason string) *task.Task {
+	result, err := m.TaskDb.Get(id)
+	if err != nil {
+		return &task.Task{ID: id, State: state}
+	}
+	t := result.(*task.Task)
+	t.State = state
+	t.TerminationReason = reason
+	t.FinishTime = time.Now().UTC()
+	m.TaskDb.Put(t.ID, t)
+	return t
+}
+
+func workflowStatus(wf *Workflow, states map[string]*task.Task) string {
+	failed := false
+	for _, wt := range wf.Tasks {
+		t := states[wt.Name]
+		switch {
+		case t.State == task.COMPLETED:
+		case t.State == task.SKIPPED, gaveUp(t):
+			failed = true
+		default:
+			return WorkflowRunning
+		}
+	}
+	if failed {
+		return WorkflowFailed
+	}
+	return WorkflowSucceeded
+}
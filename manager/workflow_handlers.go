@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (a *Api) StartWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	workflow := Workflow{}
+	err := decoder.Decode(&workflow)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	if !setNamespace(w, r, &workflow.Namespace) {
+		return
+	}
+	for _, wt := range workflow.Tasks {
+		if !allowHostAccess(w, r, wt.Task) {
+			return
+		}
+	}
+
+	wf, err := a.Manager.AddWorkflow(workflow)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid workflow: %v", err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	log.Printf("Added workflow %s (%v)\n", wf.Name, wf.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(wf)
+}
+
+func (a *Api) GetWorkflowsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	workflows := []*Workflow{}
+	for _, wf := range a.Manager.GetWorkflows() {
+		if inNamespace(r, wf.Namespace) {
+			workflows = append(workflows, wf)
+		}
+	}
+	json.NewEncoder(w).Encode(workflows)
+}
+
+func (a *Api) workflow(w http.ResponseWriter, r *http.Request) (*Workflow, bool) {
+	workflowID := chi.URLParam(r, "workflowID")
+	id, err := uuid.Parse(workflowID)
+	if err != nil {
+		msg := fmt.Sprintf("invalid workflow id %s: %v", workflowID, err)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return nil, false
+	}
+
+	wf, err := a.Manager.GetWorkflow(id)
+	if err == nil && !inNamespace(r, wf.Namespace) {
+		err = fmt.Errorf("workflow %v not found in namespace %s", id, namespace(r))
+	}
+	if err != nil {
+		log.Printf("No workflow with id %v found\n", id)
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return nil, false
+	}
+	return wf, true
+}
+
+func (a *Api) GetWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	wf, ok := a.workflow(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(wf)
+}
+
+func (a *Api) GetWorkflowTasksHandler(w http.ResponseWriter, r *http.Request) {
+	wf, ok := a.workflow(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(a.Manager.WorkflowTasks(wf))
+}
+
+func (a *Api) DeleteWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	wf, ok := a.workflow(w, r)
+	if !ok {
+		return
+	}
+	err := a.Manager.DeleteWorkflow(wf.ID)
+	if err != nil {
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: err.Error()})
+		return
+	}
+	log.Printf("Deleted workflow %s (%v)\n", wf.Name, wf.ID)
+	w.WriteHeader(204)
+}
@@ -0,0 +1,37 @@
+package manager_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/fake"
+	"github.com/jhonnyV-V/orch-in-go/manager"
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+func TestWorkflowsValidateTheirTasks(t *testing.T) {
+	c := fake.NewCluster(1)
+
+	tests := map[string]task.Task{
+		"no image":        {},
+		"negative memory": {Image: "job", Memory: -1},
+		"unknown state":   {Image: "job", State: task.State(42)},
+	}
+	for name, tk := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := c.Manager.AddWorkflow(manager.Workflow{
+				Name: "etl",
+				Tasks: []manager.WorkflowTask{
+					{Name: "extract", Task: task.Task{Image: "job"}},
+					{Name: "load", DependsOn: []string{"extract"}, Task: tk},
+				},
+			})
+			if err == nil || !strings.HasPrefix(err.Error(), "task load: ") {
+				t.Fatalf("expected task load to be invalid, got %v", err)
+			}
+		})
+	}
+	if wfs := c.Manager.GetWorkflows(); len(wfs) != 0 {
+		t.Fatalf("%d invalid workflows were added", len(wfs))
+	}
+}
@@ -7,11 +7,21 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/jhonnyV-V/orch-in-go/stats"
 	"github.com/jhonnyV-V/orch-in-go/utils"
 )
 
+// Status of a node. A Ready node answers the manager, a NotReady one is
+// alive but the manager can't reach its API, and nothing was heard from
+// an Unknown one for a while, or ever.
+const (
+	Ready    = "Ready"
+	NotReady = "NotReady"
+	Unknown  = "Unknown"
+)
+
 type Node struct {
 	Name            string
 	Ip              string
@@ -24,13 +34,28 @@ type Node struct {
 	DiskAllocated   int64
 	TaskCount       int
 	Stats           stats.Stats
+	// Hostname is the name a worker that joined by itself gave
+	Hostname string
+	Labels   map[string]string
+	Status   string
+	// Reason explains a status other than Ready
+	Reason string
+	// LastSeen is the last time the worker sent a heartbeat or answered
+	// the manager
+	LastSeen time.Time
+	// DownSince is when the node stopped being Ready, zero while it is
+	DownSince time.Time
+	// Client is used to ask the worker for its stats, http.DefaultClient
+	// when nil
+	Client *http.Client `json:"-"`
 }
 
 func NewNode(name string, api string, role string) *Node {
 	return &Node{
-		Name: name,
-		Api:  api,
-		Role: role,
+		Name:   name,
+		Api:    api,
+		Role:   role,
+		Status: Unknown,
 	}
 }
 
@@ -39,7 +64,11 @@ func (n *Node) GetStats() (*stats.Stats, error) {
 	var err error
 
 	url := fmt.Sprintf("%s/stats", n.Api)
-	resp, err = utils.HTTPWithRetry(http.Get, url)
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err = utils.HTTPWithRetry(client.Get, url)
 	if err != nil {
 		msg := fmt.Sprintf("Unable to connect to %v. Permanent failure.\n", n.Api)
 		log.Println(msg)
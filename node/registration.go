@@ -0,0 +1,43 @@
+package node
+
+import (
+	"fmt"
+	"net"
+)
+
+// Registration is what a worker sends the manager to join the cluster.
+// Address is the host:port the manager reaches the worker API at, Memory
+// is in KiB and Disk in bytes, like the stats of the worker.
+type Registration struct {
+	Name    string
+	Address string
+	Cores   int
+	Memory  int64
+	Disk    int64
+	Labels  map[string]string
+}
+
+func (r *Registration) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	host, port, err := net.SplitHostPort(r.Address)
+	if err != nil || host == "" || port == "" {
+		return fmt.Errorf("address %q must be host:port", r.Address)
+	}
+	if net.ParseIP(host) != nil && net.ParseIP(host).IsUnspecified() {
+		return fmt.Errorf("address %q can't be reached, give the address of the worker", r.Address)
+	}
+	if r.Cores < 0 || r.Memory < 0 || r.Disk < 0 {
+		return fmt.Errorf("capacity can't be negative")
+	}
+	return nil
+}
+
+// Heartbeat is sent by a worker that knows its manager, joined or listed
+// with --workers, every few seconds to tell it is alive.
+type Heartbeat struct {
+	Name      string
+	Address   string
+	TaskCount int
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/google/uuid"
+)
+
+// InMemoryStore and Store work like the task stores for any other kind of
+// resource the manager keeps, values are always passed around as *T.
+type InMemoryStore[T any] struct {
+	Db map[uuid.UUID]*T
+}
+
+func NewInMemoryStore[T any]() *InMemoryStore[T] {
+	return &InMemoryStore[T]{
+		Db: make(map[uuid.UUID]*T),
+	}
+}
+
+func (i *InMemoryStore[T]) Put(key uuid.UUID, value interface{}) error {
+	v, ok := value.(*T)
+	if !ok {
+		return fmt.Errorf("value %v is not a %T type", value, new(T))
+	}
+	i.Db[key] = v
+	return nil
+}
+
+func (i *InMemoryStore[T]) Get(key uuid.UUID) (interface{}, error) {
+	v, ok := i.Db[key]
+	if !ok {
+		return nil, fmt.Errorf("%T with key %v does not exist", new(T), key)
+	}
+	return v, nil
+}
+
+func (i *InMemoryStore[T]) List() (interface{}, error) {
+	keys := make([]uuid.UUID, 0, len(i.Db))
+	for k := range i.Db {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		return keys[a].String() < keys[b].String()
+	})
+
+	values := []*T{}
+	for _, k := range keys {
+		values = append(values, i.Db[k])
+	}
+	return values, nil
+}
+
+func (i *InMemoryStore[T]) Count() (int, error) {
+	return len(i.Db), nil
+}
+
+func (i *InMemoryStore[T]) Delete(key uuid.UUID) error {
+	delete(i.Db, key)
+	return nil
+}
+
+type Store[T any] struct {
+	Db       *bolt.DB
+	DbFile   string
+	FileMode os.FileMode
+	Bucket   string
+}
+
+func NewStore[T any](file string, mode os.FileMode, bucket string) (*Store[T], error) {
+	db, err := bolt.Open(file, mode, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file %s: %v", file, err)
+	}
+	s := &Store[T]{
+		DbFile:   file,
+		FileMode: mode,
+		Bucket:   bucket,
+		Db:       db,
+	}
+
+	err = s.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		log.Printf("failed to create bucket %s: %v\n", bucket, err)
+	}
+
+	return s, nil
+}
+
+func (s *Store[T]) Close() {
+	s.Db.Close()
+}
+
+func (s *Store[T]) Put(key uuid.UUID, value interface{}) error {
+	v, ok := value.(*T)
+	if !ok {
+		return fmt.Errorf("value %v is not a %T type", value, new(T))
+	}
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(s.Bucket)).Put([]byte(key.String()), buf)
+	})
+}
+
+func (s *Store[T]) Get(key uuid.UUID) (interface{}, error) {
+	var v T
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		result := tx.Bucket([]byte(s.Bucket)).Get([]byte(key.String()))
+		if result == nil {
+			return fmt.Errorf("%T with key %v does not exist", new(T), key)
+		}
+		return json.Unmarshal(result, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (s *Store[T]) List() (interface{}, error) {
+	values := []*T{}
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(s.Bucket)).ForEach(func(k, buf []byte) error {
+			var v T
+			err := json.Unmarshal(buf, &v)
+			if err != nil {
+				return err
+			}
+			values = append(values, &v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (s *Store[T]) Count() (int, error) {
+	count := 0
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket([]byte(s.Bucket)).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+func (s *Store[T]) Delete(key uuid.UUID) error {
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(s.Bucket)).Delete([]byte(key.String()))
+	})
+}
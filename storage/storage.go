@@ -19,6 +19,7 @@ type Storage interface {
 	Get(key uuid.UUID) (interface{}, error)
 	List() (interface{}, error)
 	Count() (int, error)
+	Delete(key uuid.UUID) error
 }
 
 type InMemoryTaskStore struct {
@@ -65,6 +66,11 @@ func (i *InMemoryTaskStore) Count() (int, error) {
 	return len(i.Db), nil
 }
 
+func (i *InMemoryTaskStore) Delete(key uuid.UUID) error {
+	delete(i.Db, key)
+	return nil
+}
+
 type InMemoryTaskEventStore struct {
 	Db map[uuid.UUID]*task.TaskEvent
 }
@@ -109,6 +115,11 @@ func (e *InMemoryTaskEventStore) Count() (int, error) {
 	return len(e.Db), nil
 }
 
+func (e *InMemoryTaskEventStore) Delete(key uuid.UUID) error {
+	delete(e.Db, key)
+	return nil
+}
+
 type TaskStore struct {
 	Db       *bolt.DB
 	DbFile   string
@@ -181,6 +192,13 @@ func (t *TaskStore) Put(key uuid.UUID, value interface{}) error {
 	})
 }
 
+func (t *TaskStore) Delete(key uuid.UUID) error {
+	return t.Db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(t.Bucket))
+		return bucket.Delete([]byte(key.String()))
+	})
+}
+
 func (t *TaskStore) Get(key uuid.UUID) (interface{}, error) {
 	var sTask task.Task
 	err := t.Db.View(func(tx *bolt.Tx) error {
@@ -302,6 +320,13 @@ func (e *EventStore) Put(key uuid.UUID, value interface{}) error {
 	})
 }
 
+func (e *EventStore) Delete(key uuid.UUID) error {
+	return e.Db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(e.Bucket))
+		return bucket.Delete([]byte(key.String()))
+	})
+}
+
 func (e *EventStore) Get(key uuid.UUID) (interface{}, error) {
 	var sTask task.TaskEvent
 	err := e.Db.View(func(tx *bolt.Tx) error {
@@ -0,0 +1,326 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Exec runs tasks as plain processes on the worker host. The task Image is
+// the path of the executable and Cmd holds its arguments, the process only
+// gets the Env of the task and runs as its User when set. Output of both
+// stdout and stderr goes to a log file under LogDir, kept until the
+// process is removed.
+type Exec struct {
+	LogDir string
+	mu     sync.Mutex
+	procs  map[string]*process
+}
+
+type process struct {
+	processState
+	cmd     *exec.Cmd
+	logFile string
+	cgroup  string
+	done    chan struct{}
+}
+
+func NewExec(logDir string) *Exec {
+	return &Exec{
+		LogDir: logDir,
+		procs:  make(map[string]*process),
+	}
+}
+
+func (e *Exec) Run(c Config) RuntimeResult {
+	var err error
+	switch {
+	case len(c.Mounts) > 0:
+		err = fmt.Errorf("mounts are not supported by the exec runtime")
+	case len(c.Entrypoint) > 0:
+		err = fmt.Errorf("entrypoint is not supported by the exec runtime, Image is the executable")
+	case len(c.ExposedPorts) > 0 || len(c.PortBindings) > 0:
+		err = fmt.Errorf("ports are not supported by the exec runtime, processes share the host network")
+	}
+	if err != nil {
+		log.Printf("Error starting process %s: %v\n", c.Image, err)
+		return RuntimeResult{Error: err}
+	}
+	attr, err := sysProcAttr(c.User)
+	if err != nil {
+		log.Printf("Error starting process %s: %v\n", c.Image, err)
+		return RuntimeResult{Error: err}
+	}
+
+	err = os.MkdirAll(e.LogDir, 0700)
+	if err != nil {
+		log.Printf("Error creating log directory %s: %v\n", e.LogDir, err)
+		return RuntimeResult{Error: err}
+	}
+
+	id := strings.ReplaceAll(uuid.New().String(), "-", "")
+	logFile := filepath.Join(e.LogDir, fmt.Sprintf("%s.log", id))
+	out, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Error creating log file %s: %v\n", logFile, err)
+		return RuntimeResult{Error: err}
+	}
+
+	cmd := exec.Command(c.Image, c.Cmd...)
+	// never leak the environment of the worker, tokens included
+	cmd.Env = append([]string{}, c.Env...)
+	cmd.Dir = c.WorkingDir
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	cgroup, cgroupFd, err := createCgroup(id, c)
+	if err != nil {
+		log.Printf("Running %s without resource limits: %v\n", id, err)
+	}
+	if cgroupFd != nil {
+		useCgroup(attr, cgroupFd)
+	}
+	cmd.SysProcAttr = attr
+
+	err = cmd.Start()
+	if cgroupFd != nil {
+		cgroupFd.Close()
+	}
+	if err != nil {
+		out.Close()
+		removeCgroup(cgroup)
+		log.Printf("Error starting process %s: %v\n", c.Image, err)
+		return RuntimeResult{Error: err}
+	}
+
+	p := &process{
+		processState: processState{
+			ID:        id,
+			Config:    c,
+			Pid:       cmd.Process.Pid,
+			Status:    StatusRunning,
+			StartTime: time.Now().UTC(),
+		},
+		cmd:     cmd,
+		logFile: logFile,
+		cgroup:  cgroup,
+		done:    make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	e.procs[id] = p
+	e.mu.Unlock()
+
+	go e.wait(p, out)
+
+	return RuntimeResult{
+		ContainerId: id,
+		Action:      "start",
+		Result:      "success",
+	}
+}
+
+func (e *Exec) wait(p *process, out *os.File) {
+	err := p.cmd.Wait()
+	out.Close()
+
+	e.mu.Lock()
+	p.Status = StatusExited
+	p.FinishTime = time.Now().UTC()
+	p.ExitCode = exitCode(p.cmd.ProcessState)
+	if err != nil && p.cmd.ProcessState == nil {
+		p.Error = err.Error()
+	}
+	e.mu.Unlock()
+
+	removeCgroup(p.cgroup)
+	close(p.done)
+}
+
+func (e *Exec) get(id string) (*process, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.procs[id]
+	if !ok {
+		return nil, fmt.Errorf("no such process: %s", id)
+	}
+	return p, nil
+}
+
+func (e *Exec) Stop(id string) RuntimeResult {
+	log.Printf("attempting to stop process: %v\n", id)
+	p, err := e.get(id)
+	if err != nil {
+		return RuntimeResult{Error: err}
+	}
+
+	select {
+	case <-p.done:
+	default:
+		terminate(p.cmd.Process)
+		select {
+		case <-p.done:
+		case <-time.After(10 * time.Second):
+			kill(p.cmd.Process)
+			<-p.done
+		}
+	}
+
+	return RuntimeResult{
+		ContainerId: id,
+		Action:      "stop",
+		Result:      "success",
+	}
+}
+
+// Remove forgets a process, stopping it first if needed, and deletes its
+// log file. Stopped processes keep their logs until then.
+func (e *Exec) Remove(id string) error {
+	p, err := e.get(id)
+	if err != nil {
+		return err
+	}
+	result := e.Stop(id)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	e.mu.Lock()
+	delete(e.procs, id)
+	e.mu.Unlock()
+	return os.Remove(p.logFile)
+}
+
+func (e *Exec) Inspect(id string) InspectResult {
+	p, err := e.get(id)
+	if err != nil {
+		log.Printf("Failed to inspect process %v\n", id)
+		return InspectResult{Error: err}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return p.inspect()
+}
+
+func (e *Exec) Logs(id string, opts LogsOptions) (io.ReadCloser, error) {
+	p, err := e.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return openLog(p.logFile, opts, p.done)
+}
+
+func (e *Exec) List() ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ids := make([]string, 0, len(e.procs))
+	for id := range e.procs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// openLog opens a log file written by a running task. With Tail set only
+// the last lines are returned, and with Follow set the reader keeps waiting
+// for new output until done is closed. The file has no timestamps, so
+// Since can't be honoured.
+func openLog(file string, opts LogsOptions, done <-chan struct{}) (io.ReadCloser, error) {
+	if opts.Since != "" {
+		return nil, ErrSinceUnsupported
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Tail != "" && opts.Tail != "all" {
+		n, err := strconv.Atoi(opts.Tail)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid tail value %q", opts.Tail)
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		lines := bytes.SplitAfter(data, []byte("\n"))
+		if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+			lines = lines[:len(lines)-1]
+		}
+		if n < len(lines) {
+			lines = lines[len(lines)-n:]
+		}
+		if !opts.Follow {
+			f.Close()
+			return io.NopCloser(bytes.NewReader(bytes.Join(lines, nil))), nil
+		}
+		return &followReader{
+			head: bytes.NewReader(bytes.Join(lines, nil)),
+			f:    f,
+			done: done,
+		}, nil
+	}
+
+	if !opts.Follow {
+		return f, nil
+	}
+	return &followReader{f: f, done: done}, nil
+}
+
+type followReader struct {
+	head io.Reader
+	f    *os.File
+	done <-chan struct{}
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	if r.head != nil {
+		n, err := r.head.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		r.head = nil
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	for {
+		n, err := r.f.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+		select {
+		case <-r.done:
+			// one last read to drain what was written before exiting
+			n, err = r.f.Read(p)
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
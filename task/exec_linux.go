@@ -0,0 +1,154 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// createCgroup puts the process for a task in its own cgroup v2 group with
+// the memory and cpu limits of the task. It fails when the host does not
+// use cgroup v2 or the worker is not allowed to manage it.
+func createCgroup(id string, c Config) (string, *os.File, error) {
+	if c.Memory == 0 && c.Cpu == 0 {
+		return "", nil, nil
+	}
+
+	_, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return "", nil, fmt.Errorf("cgroup v2 not available")
+	}
+
+	parent := filepath.Join(cgroupRoot, "cube")
+	err = os.MkdirAll(parent, 0755)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, dir := range []string{cgroupRoot, parent} {
+		err = os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+memory +cpu"), 0644)
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to enable controllers in %s: %v", dir, err)
+		}
+	}
+
+	cgroup := filepath.Join(parent, id)
+	err = os.Mkdir(cgroup, 0755)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if c.Memory > 0 {
+		err = os.WriteFile(filepath.Join(cgroup, "memory.max"), []byte(strconv.FormatInt(c.Memory, 10)), 0644)
+		if err != nil {
+			removeCgroup(cgroup)
+			return "", nil, err
+		}
+	}
+	if c.Cpu > 0 {
+		period := 100000
+		quota := int(c.Cpu * float64(period))
+		err = os.WriteFile(filepath.Join(cgroup, "cpu.max"), []byte(fmt.Sprintf("%d %d", quota, period)), 0644)
+		if err != nil {
+			removeCgroup(cgroup)
+			return "", nil, err
+		}
+	}
+
+	fd, err := os.Open(cgroup)
+	if err != nil {
+		removeCgroup(cgroup)
+		return "", nil, err
+	}
+	return cgroup, fd, nil
+}
+
+func removeCgroup(cgroup string) {
+	if cgroup != "" {
+		os.Remove(cgroup)
+	}
+}
+
+// credential turns the user of a task, "name", "uid", "name:group" or
+// "uid:gid", into the credential the process runs with. An empty user runs
+// the process as the worker.
+func credential(u string) (*syscall.Credential, error) {
+	if u == "" {
+		return nil, nil
+	}
+	name, group, hasGroup := strings.Cut(u, ":")
+
+	var uid, gid string
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		uid, gid = name, name
+		if found, err := user.LookupId(name); err == nil {
+			gid = found.Gid
+		}
+	} else {
+		found, err := user.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user %q: %v", u, err)
+		}
+		uid, gid = found.Uid, found.Gid
+	}
+	if hasGroup {
+		gid = group
+		if _, err := strconv.ParseUint(group, 10, 32); err != nil {
+			found, err := user.LookupGroup(group)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user %q: %v", u, err)
+			}
+			gid = found.Gid
+		}
+	}
+
+	id, _ := strconv.ParseUint(uid, 10, 32)
+	g, err := strconv.ParseUint(gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user %q: group id %q", u, gid)
+	}
+	return &syscall.Credential{Uid: uint32(id), Gid: uint32(g)}, nil
+}
+
+// sysProcAttr starts the process in its own process group, as the user of
+// the task when it has one.
+func sysProcAttr(u string) (*syscall.SysProcAttr, error) {
+	cred, err := credential(u)
+	if err != nil {
+		return nil, err
+	}
+	return &syscall.SysProcAttr{Setpgid: true, Credential: cred}, nil
+}
+
+func useCgroup(attr *syscall.SysProcAttr, cgroupFd *os.File) {
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(cgroupFd.Fd())
+}
+
+// terminate and kill signal the whole process group so children spawned
+// by the task go away with it.
+func terminate(p *os.Process) {
+	syscall.Kill(-p.Pid, syscall.SIGTERM)
+}
+
+func kill(p *os.Process) {
+	syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
+
+// exitCode follows the docker convention of 128 + signal number for
+// processes that were killed by a signal.
+func exitCode(ps *os.ProcessState) int {
+	if ps == nil {
+		return -1
+	}
+	status, ok := ps.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return ps.ExitCode()
+}
@@ -0,0 +1,39 @@
+//go:build !linux
+
+package task
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func createCgroup(id string, c Config) (string, *os.File, error) {
+	return "", nil, nil
+}
+
+func removeCgroup(cgroup string) {}
+
+func sysProcAttr(u string) (*syscall.SysProcAttr, error) {
+	if u != "" {
+		return nil, fmt.Errorf("user is not supported by the exec runtime on this platform")
+	}
+	return nil, nil
+}
+
+func useCgroup(attr *syscall.SysProcAttr, cgroupFd *os.File) {}
+
+func terminate(p *os.Process) {
+	p.Signal(os.Interrupt)
+}
+
+func kill(p *os.Process) {
+	p.Kill()
+}
+
+func exitCode(ps *os.ProcessState) int {
+	if ps == nil {
+		return -1
+	}
+	return ps.ExitCode()
+}
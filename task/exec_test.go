@@ -0,0 +1,128 @@
+package task_test
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// sh runs script with the exec runtime of a test.
+func sh(t *testing.T, e *task.Exec, script string) string {
+	t.Helper()
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	result := e.Run(task.Config{Name: "sh", Image: "/bin/sh", Cmd: []string{"-c", script}})
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	return result.ContainerId
+}
+
+// waitExited waits for a task run by r to exit and returns its state.
+func waitExited(t *testing.T, r task.Runtime, id string) *task.ContainerStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		result := r.Inspect(id)
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+		if result.Container.Status == task.StatusExited {
+			return result.Container
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s is still running", id)
+	return nil
+}
+
+func readLogs(t *testing.T, e *task.Exec, id string, opts task.LogsOptions) string {
+	t.Helper()
+	logs, err := e.Logs(id, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logs.Close()
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(logs)
+		out <- data
+	}()
+	select {
+	case data := <-out:
+		return string(data)
+	case <-time.After(10 * time.Second):
+		t.Fatal("logs didn't end")
+		return ""
+	}
+}
+
+func TestExecExitCodes(t *testing.T) {
+	e := task.NewExec(t.TempDir())
+	tests := map[string]int{
+		"exit 0": 0,
+		"exit 3": 3,
+	}
+	if runtime.GOOS == "linux" {
+		// killed by SIGTERM, like docker reports it
+		tests["kill -TERM $$"] = 143
+	}
+	for script, want := range tests {
+		state := waitExited(t, e, sh(t, e, script))
+		if state.ExitCode != want {
+			t.Errorf("%q exited with %d, expected %d", script, state.ExitCode, want)
+		}
+	}
+}
+
+func TestExecStopKeepsTheLogsUntilRemove(t *testing.T) {
+	e := task.NewExec(t.TempDir())
+	id := sh(t, e, "echo started; exec sleep 60")
+	for readLogs(t, e, id, task.LogsOptions{}) == "" {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if result := e.Stop(id); result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	if state := waitExited(t, e, id); state.Status != task.StatusExited {
+		t.Fatalf("stopped process is %s", state.Status)
+	}
+	if logs := readLogs(t, e, id, task.LogsOptions{}); logs != "started\n" {
+		t.Fatalf("stopped process logged %q", logs)
+	}
+
+	if err := e.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Logs(id, task.LogsOptions{}); err == nil {
+		t.Fatal("removed process still has logs")
+	}
+	files, _ := os.ReadDir(e.LogDir)
+	if len(files) != 0 {
+		t.Fatalf("log files left after remove: %v", files)
+	}
+}
+
+func TestExecLogsFollowUntilTheProcessExits(t *testing.T) {
+	e := task.NewExec(t.TempDir())
+	id := sh(t, e, "echo one; echo two; sleep 0.5; echo three")
+
+	if logs := readLogs(t, e, id, task.LogsOptions{Follow: true}); logs != "one\ntwo\nthree\n" {
+		t.Fatalf("followed logs are %q", logs)
+	}
+	if logs := readLogs(t, e, id, task.LogsOptions{Tail: "2"}); logs != "two\nthree\n" {
+		t.Fatalf("tail of the logs is %q", logs)
+	}
+	if logs := readLogs(t, e, id, task.LogsOptions{Tail: "1", Follow: true}); logs != "three\n" {
+		t.Fatalf("followed tail of the logs is %q", logs)
+	}
+	if _, err := e.Logs(id, task.LogsOptions{Since: "1m"}); err != task.ErrSinceUnsupported {
+		t.Fatalf("since gave %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package task
+
+import "github.com/tetratelabs/wazero"
+
+// WasmMemoryPages lets the tests check how memory limits become pages.
+func WasmMemoryPages(memory int64) uint32 {
+	return wasmMemoryPages(memory)
+}
+
+// WasmFSConfig lets the tests check which mounts a module can get.
+func WasmFSConfig(c Config) (wazero.FSConfig, error) {
+	return wasmFSConfig(c)
+}
@@ -0,0 +1,125 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+)
+
+const (
+	MountVolume = "volume"
+	MountBind   = "bind"
+	MountTmpfs  = "tmpfs"
+)
+
+// Volume policies decide what happens to the named volumes of a task once
+// it is stopped. Anonymous volumes are always removed with the container.
+const (
+	VolumeRetain = "retain"
+	VolumeRemove = "remove"
+)
+
+const (
+	taskLabel         = "cube.task"
+	volumePolicyLabel = "cube.volume-policy"
+)
+
+// Mount is a volume, host directory or tmpfs mounted into a task. Source is
+// the volume name for volumes (empty for an anonymous one), the host path
+// for binds and is unused for tmpfs. Size only applies to tmpfs mounts.
+type Mount struct {
+	Type     string
+	Source   string
+	Target   string
+	ReadOnly bool
+	Size     int64
+}
+
+func NewMounts(mounts []Mount) ([]mount.Mount, error) {
+	var result []mount.Mount
+	for _, m := range mounts {
+		if !filepath.IsAbs(m.Target) {
+			return nil, fmt.Errorf("mount target %q must be an absolute path", m.Target)
+		}
+
+		dm := mount.Mount{
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		}
+		switch m.Type {
+		case MountVolume, "":
+			dm.Type = mount.TypeVolume
+		case MountBind:
+			if !filepath.IsAbs(m.Source) {
+				return nil, fmt.Errorf("bind mount source %q must be an absolute path", m.Source)
+			}
+			dm.Type = mount.TypeBind
+		case MountTmpfs:
+			dm.Type = mount.TypeTmpfs
+			dm.Source = ""
+			dm.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: m.Size}
+		default:
+			return nil, fmt.Errorf("unknown mount type %q", m.Type)
+		}
+		result = append(result, dm)
+	}
+	return result, nil
+}
+
+// createVolumes makes sure the named volumes of a task exist before the
+// container is created so they carry the labels of the task.
+func (d *Docker) createVolumes(ctx context.Context, c Config) error {
+	for _, m := range c.Mounts {
+		if (m.Type != MountVolume && m.Type != "") || m.Source == "" {
+			continue
+		}
+		_, err := d.Client.VolumeCreate(ctx, volume.CreateOptions{
+			Name:   m.Source,
+			Labels: map[string]string{taskLabel: c.Name},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to create volume %s: %v", m.Source, err)
+		}
+	}
+	return nil
+}
+
+// containerVolumes returns the volume policy of a container and its named
+// volumes, to be removed with it.
+func (d *Docker) containerVolumes(ctx context.Context, id string) (string, []string) {
+	info, err := d.Client.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", nil
+	}
+	var volumes []string
+	for _, m := range info.Mounts {
+		if m.Type == mount.TypeVolume && m.Name != "" {
+			volumes = append(volumes, m.Name)
+		}
+	}
+	if info.Config == nil {
+		return "", volumes
+	}
+	return info.Config.Labels[volumePolicyLabel], volumes
+}
+
+// removeVolumes deletes the named volumes of a stopped container when its
+// task asked for them to be removed.
+func (d *Docker) removeVolumes(ctx context.Context, policy string, volumes []string) {
+	if policy != VolumeRemove {
+		return
+	}
+	for _, v := range volumes {
+		err := d.Client.VolumeRemove(ctx, v, false)
+		// anonymous volumes are already gone with the container
+		if err != nil && !errdefs.IsNotFound(err) {
+			log.Printf("Error removing volume %s: %v\n", v, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// Runtime is what a worker uses to run the process backing a task.
+// Docker is the default implementation.
+type Runtime interface {
+	Run(c Config) RuntimeResult
+	Stop(id string) RuntimeResult
+	Inspect(id string) InspectResult
+	Logs(id string, opts LogsOptions) (io.ReadCloser, error)
+	List() ([]string, error)
+}
+
+// Remover is implemented by the runtimes that keep what a stopped task
+// left behind, like its logs, until it is removed. Docker removes
+// containers as soon as they are stopped.
+type Remover interface {
+	Remove(id string) error
+}
+
+// Execer is implemented by the runtimes able to run an extra command
+// inside a running task. Exec blocks until the command exits and returns
+// its exit code.
+type Execer interface {
+	Exec(ctx context.Context, id string, opts ExecOptions, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+}
+
+type ExecOptions struct {
+	Cmd []string
+	Tty bool
+}
+
+type LogsOptions struct {
+	Follow bool
+	Tail   string
+	Since  string
+}
+
+// ErrSinceUnsupported is returned by the runtimes whose logs have no
+// timestamps to filter on.
+var ErrSinceUnsupported = errors.New("since is not supported by the runtime of this task")
+
+// RuntimeResult is what a runtime answers when asked to start or stop
+// the process backing a task.
+type RuntimeResult struct {
+	Error       error
+	Action      string
+	ContainerId string
+	Result      string
+}
+
+// InspectResult holds the status of the process backing a task, Container
+// is nil when the runtime doesn't know about it.
+type InspectResult struct {
+	Error     error
+	Container *ContainerStatus
+}
+
+// Statuses a runtime reports for the process backing a task. Docker has a
+// few more, like paused or restarting, a worker only tells running
+// processes from exited ones.
+const (
+	StatusRunning = "running"
+	StatusExited  = "exited"
+)
+
+// ContainerStatus describes the process backing a task, whichever runtime
+// runs it.
+type ContainerStatus struct {
+	ID         string
+	Name       string
+	Image      string
+	Status     string
+	Pid        int
+	ExitCode   int
+	OOMKilled  bool
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	HostPorts  nat.PortMap
+	// DiskUsage is the size of what the task wrote, nil when the runtime
+	// can't tell
+	DiskUsage *int64
+}
+
+// processState is the bookkeeping kept by runtimes that run tasks without
+// docker.
+type processState struct {
+	ID         string
+	Config     Config
+	Pid        int
+	Status     string
+	ExitCode   int
+	Error      string
+	StartTime  time.Time
+	FinishTime time.Time
+}
+
+func (p *processState) inspect() InspectResult {
+	return InspectResult{
+		Container: &ContainerStatus{
+			ID:         p.ID,
+			Name:       p.Config.Name,
+			Image:      p.Config.Image,
+			Status:     p.Status,
+			Pid:        p.Pid,
+			ExitCode:   p.ExitCode,
+			Error:      p.Error,
+			StartedAt:  p.StartTime,
+			FinishedAt: p.FinishTime,
+		},
+	}
+}
@@ -2,16 +2,21 @@ package task
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"math"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
 	"github.com/moby/moby/pkg/stdcopy"
@@ -25,20 +30,48 @@ const (
 	RUNNING
 	COMPLETED
 	FAILED
+	SKIPPED
 )
 
 func (s State) String() []string {
-	return []string{"Pending", "Scheduled", "Running", "Completed", "Failed"}
+	return []string{"Pending", "Scheduled", "Running", "Completed", "Failed", "Skipped"}
 }
 
+// failed tasks go back to scheduled when the manager restarts them
 var stateTransitionMap = map[State][]State{
-	PENDING:   {SCHEDULED},
-	SCHEDULED: {RUNNING, FAILED, SCHEDULED},
+	PENDING:   {SCHEDULED, SKIPPED},
+	SCHEDULED: {RUNNING, FAILED, SCHEDULED, COMPLETED},
 	RUNNING:   {COMPLETED, FAILED, RUNNING},
 	COMPLETED: {},
-	FAILED:    {},
+	FAILED:    {SCHEDULED},
+	SKIPPED:   {},
 }
 
+// Kinds of task. Services are expected to run until stopped, jobs run to
+// completion and their exit code decides whether they succeeded.
+const (
+	KindService = "service"
+	KindJob     = "job"
+)
+
+// Restart policies understood by the manager for jobs. Services keep
+// passing RestartPolicy to docker as is.
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+)
+
+// Termination reasons recorded on a task once its container exits.
+const (
+	ReasonCompleted        = "Completed"
+	ReasonError            = "Error"
+	ReasonOOMKilled        = "OOMKilled"
+	ReasonContainerMissing = "ContainerMissing"
+	ReasonUpstreamFailed   = "UpstreamFailed"
+	ReasonRejected         = "Rejected"
+	ReasonLost             = "Lost"
+)
+
 func Contains(states []State, state State) bool {
 	for _, s := range states {
 		if state == s {
@@ -53,22 +86,37 @@ func ValidStateTransition(src, dst State) bool {
 }
 
 type Task struct {
-	ID            uuid.UUID
-	ContainerID   string
-	Name          string
-	State         State
-	Image         string
-	Memory        int64
-	Disk          int64
-	Cpu           float64
-	ExposedPorts  nat.PortSet
-	PortBindings  map[string]string
-	HostPorts     nat.PortMap
-	RestartPolicy string
-	StartTime     time.Time
-	FinishTime    time.Time
-	HealthCheck   string
-	RestartCount  int
+	ID                uuid.UUID
+	ContainerID       string
+	Name              string
+	Namespace         string
+	State             State
+	Image             string
+	Memory            int64
+	Disk              int64
+	DiskUsage         int64
+	Cpu               float64
+	ExposedPorts      nat.PortSet
+	PortBindings      map[string]string
+	HostPorts         nat.PortMap
+	RestartPolicy     string
+	StartTime         time.Time
+	FinishTime        time.Time
+	HealthCheck       string
+	RestartCount      int
+	Kind              string
+	ExitCode          int
+	TerminationReason string
+	Runtime           string
+	Entrypoint        []string
+	Cmd               []string
+	Env               []string
+	WorkingDir        string
+	User              string
+	Mounts            []Mount
+	VolumePolicy      string
+	ServiceID         uuid.UUID
+	Revision          int
 }
 
 type TaskEvent struct {
@@ -84,145 +132,423 @@ type Config struct {
 	AttachStdout  bool
 	AttachStderr  bool
 	ExposedPorts  nat.PortSet
+	PortBindings  map[string]string
+	Entrypoint    []string
 	Cmd           []string
 	Image         string
 	Cpu           float64
 	Memory        int64
 	Disk          int64
 	Env           []string
+	WorkingDir    string
+	User          string
+	Mounts        []Mount
+	VolumePolicy  string
 	RestartPolicy string
+	Runtime       string
 }
 
 type Docker struct {
 	Client *client.Client
-	Config Config
 }
 
-type DockerResult struct {
-	Error       error
-	Action      string
-	ContainerId string
-	Result      string
+func (t *Task) IsJob() bool {
+	return t.Kind == KindJob
 }
 
-type DockerInspectResult struct {
-	Error     error
-	Container *types.ContainerJSON
+// IsWasm tells whether a task runs on the wasm runtime, asked for by name
+// or picked for a .wasm image.
+func (t *Task) IsWasm() bool {
+	return t.Runtime == "wasm" || (t.Runtime == "" && strings.HasSuffix(t.Image, ".wasm"))
+}
+
+// ShouldRestart tells whether the manager should restart a failed task.
+// Jobs only come back when their policy asks for it, and tasks that failed
+// because a task they depend on did never ran in the first place. Lost
+// tasks were replaced on another worker.
+func (t *Task) ShouldRestart() bool {
+	if t.TerminationReason == ReasonUpstreamFailed || t.TerminationReason == ReasonRejected || t.TerminationReason == ReasonLost {
+		return false
+	}
+	if t.IsJob() {
+		return t.RestartPolicy == RestartOnFailure
+	}
+	return true
+}
+
+// DefaultNamespace is the namespace of tasks that don't name one.
+const DefaultNamespace = "default"
+
+// ContainerName is the name of the task on its worker. Tasks outside the
+// default namespace get the namespace as a prefix so that tasks with the
+// same name in different namespaces don't clash.
+func (t *Task) ContainerName() string {
+	if t.Namespace == "" || t.Namespace == DefaultNamespace {
+		return t.Name
+	}
+	return t.Namespace + "_" + t.Name
+}
+
+// namespacedMounts prefixes the named volumes of a task outside the default
+// namespace the same way as its container name, namespaces don't share
+// volumes.
+func (t *Task) namespacedMounts() []Mount {
+	if t.Namespace == "" || t.Namespace == DefaultNamespace {
+		return t.Mounts
+	}
+	mounts := make([]Mount, len(t.Mounts))
+	for i, m := range t.Mounts {
+		if m.Type == MountVolume && m.Source != "" {
+			m.Source = t.Namespace + "_" + m.Source
+		}
+		mounts[i] = m
+	}
+	return mounts
 }
 
 func NewConfig(t *Task) *Config {
+	restartPolicy := t.RestartPolicy
+	if t.IsJob() {
+		// restarts of jobs are decided by the manager, docker restarting
+		// the container would hide the exit code
+		restartPolicy = ""
+	}
+
 	return &Config{
-		Name:          t.Name,
+		Name:          t.ContainerName(),
 		ExposedPorts:  t.ExposedPorts,
+		PortBindings:  t.PortBindings,
 		Image:         t.Image,
 		Cpu:           t.Cpu,
 		Memory:        t.Memory,
 		Disk:          t.Disk,
-		RestartPolicy: t.RestartPolicy,
+		Entrypoint:    t.Entrypoint,
+		Cmd:           t.Cmd,
+		Env:           t.Env,
+		WorkingDir:    t.WorkingDir,
+		User:          t.User,
+		Mounts:        t.namespacedMounts(),
+		VolumePolicy:  t.VolumePolicy,
+		RestartPolicy: restartPolicy,
+		Runtime:       t.Runtime,
+	}
+}
+
+// NewPortBindings turns the PortBindings of a task, a map of container port
+// ("7777/tcp") to host port ("7777" or "127.0.0.1:7777"), into docker
+// bindings. Bound ports are added to the exposed ones.
+func NewPortBindings(exposed nat.PortSet, bindings map[string]string) (nat.PortSet, nat.PortMap, error) {
+	ports := nat.PortSet{}
+	for p := range exposed {
+		ports[p] = struct{}{}
+	}
+
+	portMap := nat.PortMap{}
+	for containerPort, hostPort := range bindings {
+		proto, port := nat.SplitProtoPort(containerPort)
+		p, err := nat.NewPort(proto, port)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid container port %q: %v", containerPort, err)
+		}
+
+		binding := nat.PortBinding{HostPort: hostPort}
+		if strings.Contains(hostPort, ":") {
+			ip, port, err := net.SplitHostPort(hostPort)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid host port %q: %v", hostPort, err)
+			}
+			binding = nat.PortBinding{HostIP: ip, HostPort: port}
+		}
+		_, err = nat.ParsePort(binding.HostPort)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid host port %q: %v", hostPort, err)
+		}
+
+		ports[p] = struct{}{}
+		portMap[p] = append(portMap[p], binding)
 	}
+
+	return ports, portMap, nil
 }
 
-func NewDocker(c *Config) *Docker {
+func isStorageOptUnsupported(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "storage-opt") || strings.Contains(msg, "storage opt")
+}
+
+func NewDocker() *Docker {
 	dc, _ := client.NewClientWithOpts(client.FromEnv)
 	return &Docker{
 		Client: dc,
-		Config: *c,
 	}
 }
 
-func (d *Docker) Run() DockerResult {
+func (d *Docker) Run(c Config) RuntimeResult {
 	ctx := context.Background()
 	reader, err := d.Client.ImagePull(
-		ctx, d.Config.Image, image.PullOptions{},
+		ctx, c.Image, image.PullOptions{},
 	)
 
 	if err != nil {
-		log.Printf("Error pulling image: %s %v\n", d.Config.Image, err)
-		return DockerResult{Error: err}
+		log.Printf("Error pulling image: %s %v\n", c.Image, err)
+		return RuntimeResult{Error: err}
 	}
 
 	io.Copy(os.Stdout, reader)
 	restartPolicy := container.RestartPolicy{
-		Name: container.RestartPolicyMode(d.Config.RestartPolicy),
+		Name: container.RestartPolicyMode(c.RestartPolicy),
 	}
 
 	resources := container.Resources{
-		Memory:   d.Config.Memory,
-		NanoCPUs: int64(d.Config.Cpu * math.Pow(10, 9)),
+		Memory:   c.Memory,
+		NanoCPUs: int64(c.Cpu * math.Pow(10, 9)),
+	}
+
+	exposedPorts, portBindings, err := NewPortBindings(c.ExposedPorts, c.PortBindings)
+	if err != nil {
+		log.Printf("Error parsing port bindings for %s %v\n", c.Name, err)
+		return RuntimeResult{Error: err}
+	}
+
+	mounts, err := NewMounts(c.Mounts)
+	if err != nil {
+		log.Printf("Error parsing mounts for %s %v\n", c.Name, err)
+		return RuntimeResult{Error: err}
+	}
+
+	err = d.createVolumes(ctx, c)
+	if err != nil {
+		log.Printf("Error creating volumes for %s %v\n", c.Name, err)
+		return RuntimeResult{Error: err}
 	}
 
 	conf := container.Config{
-		Image:        d.Config.Image,
+		Image:        c.Image,
 		Tty:          false,
-		Env:          d.Config.Env,
-		ExposedPorts: d.Config.ExposedPorts,
+		Entrypoint:   c.Entrypoint,
+		Cmd:          c.Cmd,
+		Env:          c.Env,
+		WorkingDir:   c.WorkingDir,
+		User:         c.User,
+		ExposedPorts: exposedPorts,
+		Labels: map[string]string{
+			taskLabel:         c.Name,
+			volumePolicyLabel: c.VolumePolicy,
+		},
 	}
 
+	// explicit bindings win, any other exposed port gets a random host port
 	hostConfig := container.HostConfig{
 		RestartPolicy:   restartPolicy,
 		Resources:       resources,
+		PortBindings:    portBindings,
 		PublishAllPorts: true,
+		Mounts:          mounts,
+	}
+	if c.Disk > 0 {
+		hostConfig.StorageOpt = map[string]string{"size": strconv.FormatInt(c.Disk, 10)}
 	}
 
-	resp, err := d.Client.ContainerCreate(ctx, &conf, &hostConfig, nil, nil, d.Config.Name)
+	resp, err := d.Client.ContainerCreate(ctx, &conf, &hostConfig, nil, nil, c.Name)
+	if err != nil && hostConfig.StorageOpt != nil && isStorageOptUnsupported(err) {
+		// only some storage drivers (and backing filesystems) can enforce a
+		// size, run without the quota instead of refusing the task
+		log.Printf("Storage driver can't limit disk usage of %s, creating it without a quota\n", c.Name)
+		hostConfig.StorageOpt = nil
+		resp, err = d.Client.ContainerCreate(ctx, &conf, &hostConfig, nil, nil, c.Name)
+	}
 	if err != nil {
-		log.Printf("Error creating container using image: %s %v\n", d.Config.Image, err)
-		return DockerResult{Error: err}
+		log.Printf("Error creating container using image: %s %v\n", c.Image, err)
+		return RuntimeResult{Error: err}
 	}
 
 	err = d.Client.ContainerStart(ctx, resp.ID, container.StartOptions{})
 
 	if err != nil {
 		log.Printf("Error starting container: %s %v\n", resp.ID, err)
-		return DockerResult{Error: err}
-	}
-
-	out, err := d.Client.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
-
-	if err != nil {
-		log.Printf("Error getting logs for container: %s %v\n", resp.ID, err)
-		return DockerResult{Error: err}
+		return RuntimeResult{Error: err}
 	}
 
-	stdcopy.StdCopy(os.Stdout, os.Stderr, out)
-
-	return DockerResult{
+	return RuntimeResult{
 		ContainerId: resp.ID,
 		Action:      "start",
 		Result:      "success",
 	}
 }
 
-func (d *Docker) Stop(id string) DockerResult {
+func (d *Docker) Stop(id string) RuntimeResult {
 	log.Printf("attempting to stop container: %v\n", id)
 	ctx := context.Background()
+	policy, volumes := d.containerVolumes(ctx, id)
 
 	err := d.Client.ContainerStop(ctx, id, container.StopOptions{})
 	if err != nil {
 		log.Printf("Error stopping container: %s %v\n", id, err)
-		return DockerResult{Error: err}
+		return RuntimeResult{Error: err}
 	}
 
 	err = d.Client.ContainerRemove(ctx, id, container.RemoveOptions{RemoveVolumes: true, RemoveLinks: false, Force: false})
 	if err != nil {
 		log.Printf("Error removing container: %s %v\n", id, err)
-		return DockerResult{Error: err}
+		return RuntimeResult{Error: err}
 	}
+	d.removeVolumes(ctx, policy, volumes)
 
-	return DockerResult{
+	return RuntimeResult{
 		ContainerId: id,
 		Action:      "stop",
 		Result:      "success",
 	}
 }
 
-func (d *Docker) Inspect(containerID string) DockerInspectResult {
-	dc, _ := client.NewClientWithOpts(client.FromEnv)
+// Remove deletes a container whether it runs or not, with the volumes its
+// task asked to be removed. A container that is already gone is fine.
+func (d *Docker) Remove(id string) error {
 	ctx := context.Background()
-	resp, err := dc.ContainerInspect(ctx, containerID)
+	policy, volumes := d.containerVolumes(ctx, id)
+
+	err := d.Client.ContainerRemove(ctx, id, container.RemoveOptions{RemoveVolumes: true, Force: true})
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	d.removeVolumes(ctx, policy, volumes)
+	return nil
+}
+
+func (d *Docker) Inspect(containerID string) InspectResult {
+	ctx := context.Background()
+	resp, err := d.Client.ContainerInspect(ctx, containerID)
+	if err == nil && resp.HostConfig != nil && resp.HostConfig.StorageOpt["size"] != "" && resp.State != nil && resp.State.Running {
+		// docker has to walk the writable layer for its size, only
+		// tasks with a disk limit need it
+		resp, _, err = d.Client.ContainerInspectWithRaw(ctx, containerID, true)
+	}
 	if err != nil {
 		log.Printf("Failed to inspect container %v\n", containerID)
-		return DockerInspectResult{Error: err}
+		return InspectResult{Error: err}
+	}
+	return InspectResult{Container: containerStatus(resp)}
+}
+
+// containerStatus converts what docker says about a container into what
+// the worker understands.
+func containerStatus(c types.ContainerJSON) *ContainerStatus {
+	status := &ContainerStatus{DiskUsage: c.SizeRw}
+	if c.ContainerJSONBase != nil {
+		status.ID = c.ID
+		status.Name = c.Name
+		status.Image = c.Image
+	}
+	if c.ContainerJSONBase != nil && c.State != nil {
+		status.Status = c.State.Status
+		status.Pid = c.State.Pid
+		status.ExitCode = c.State.ExitCode
+		status.OOMKilled = c.State.OOMKilled
+		status.Error = c.State.Error
+		status.StartedAt, _ = time.Parse(time.RFC3339Nano, c.State.StartedAt)
+		status.FinishedAt, _ = time.Parse(time.RFC3339Nano, c.State.FinishedAt)
+	}
+	if c.NetworkSettings != nil {
+		status.HostPorts = c.NetworkSettings.Ports
+	}
+	return status
+}
+
+func (d *Docker) Logs(containerID string, opts LogsOptions) (io.ReadCloser, error) {
+	ctx := context.Background()
+	out, err := d.Client.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Tail:       opts.Tail,
+		Since:      opts.Since,
+	})
+	if err != nil {
+		log.Printf("Error getting logs for container: %s %v\n", containerID, err)
+		return nil, err
+	}
+
+	// containers are created without a tty, so stdout and stderr come
+	// multiplexed and have to be split back into plain text
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, out)
+		out.Close()
+		pw.CloseWithError(err)
+	}()
+
+	return pr, nil
+}
+
+func (d *Docker) List() ([]string, error) {
+	ctx := context.Background()
+	containers, err := d.Client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		log.Printf("Error listing containers %v\n", err)
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(containers))
+	for _, c := range containers {
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+func (d *Docker) Exec(ctx context.Context, containerID string, opts ExecOptions, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	exec, err := d.Client.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          opts.Cmd,
+		Tty:          opts.Tty,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		log.Printf("Error creating exec in container: %s %v\n", containerID, err)
+		return -1, err
+	}
+
+	hijacked, err := d.Client.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{Tty: opts.Tty})
+	if err != nil {
+		log.Printf("Error attaching to exec in container: %s %v\n", containerID, err)
+		return -1, err
+	}
+	defer hijacked.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			hijacked.Close()
+		case <-done:
+		}
+	}()
+
+	if stdin != nil {
+		go func() {
+			io.Copy(hijacked.Conn, stdin)
+			hijacked.CloseWrite()
+		}()
+	}
+
+	// without a tty docker multiplexes stdout and stderr in one stream
+	if opts.Tty {
+		_, err = io.Copy(stdout, hijacked.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, hijacked.Reader)
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Error reading output of exec in container: %s %v\n", containerID, err)
+		return -1, err
+	}
+
+	inspect, err := d.Client.ContainerExecInspect(context.Background(), exec.ID)
+	if err != nil {
+		return -1, err
 	}
-	return DockerInspectResult{Container: &resp}
+	return inspect.ExitCode, nil
 }
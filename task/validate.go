@@ -0,0 +1,141 @@
+package task
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// FieldError is a problem with one field of a task, Field is the path of
+// the field as it appears in the JSON body.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// FieldErrors lists every problem found in a spec, not just the first one.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *FieldErrors) Add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Prefix nests the errors under field, for specs embedded in others.
+func (e FieldErrors) Prefix(field string) FieldErrors {
+	nested := make(FieldErrors, len(e))
+	for i, err := range e {
+		nested[i] = FieldError{Field: field + "." + err.Field, Message: err.Message}
+	}
+	return nested
+}
+
+func (s State) Valid() bool {
+	return s >= PENDING && s <= SKIPPED
+}
+
+// Validate checks the fields of a task a user can set. It returns nil when
+// the task is fine.
+func (t *Task) Validate() FieldErrors {
+	var errs FieldErrors
+	if t.Image == "" {
+		errs.Add("Image", "is required")
+	}
+	if t.Memory < 0 {
+		errs.Add("Memory", "can't be negative")
+	}
+	if t.Disk < 0 {
+		errs.Add("Disk", "can't be negative")
+	}
+	if t.Cpu < 0 {
+		errs.Add("Cpu", "can't be negative")
+	}
+	if !t.State.Valid() {
+		errs.Add("State", "unknown state %d", t.State)
+	}
+
+	switch t.Kind {
+	case "", KindService:
+		switch t.RestartPolicy {
+		case "", "no", "always", "unless-stopped", RestartOnFailure:
+		default:
+			errs.Add("RestartPolicy", "unknown restart policy %q", t.RestartPolicy)
+		}
+	case KindJob:
+		switch t.RestartPolicy {
+		case "", RestartNever, RestartOnFailure:
+		default:
+			errs.Add("RestartPolicy", "jobs can only use %q or %q", RestartNever, RestartOnFailure)
+		}
+	default:
+		errs.Add("Kind", "unknown kind %q", t.Kind)
+	}
+
+	if t.HealthCheck != "" && !strings.HasPrefix(t.HealthCheck, "/") {
+		errs.Add("HealthCheck", "must be a path starting with /")
+	}
+	if _, _, err := NewPortBindings(t.ExposedPorts, t.PortBindings); err != nil {
+		errs.Add("PortBindings", "%v", err)
+	}
+	for i, m := range t.Mounts {
+		if _, err := NewMounts([]Mount{m}); err != nil {
+			errs.Add(fmt.Sprintf("Mounts[%d]", i), "%v", err)
+		}
+	}
+	switch t.VolumePolicy {
+	case "", VolumeRetain, VolumeRemove:
+	default:
+		errs.Add("VolumePolicy", "unknown volume policy %q", t.VolumePolicy)
+	}
+	for i, e := range t.Env {
+		if !strings.Contains(e, "=") {
+			errs.Add(fmt.Sprintf("Env[%d]", i), "must be KEY=value")
+		}
+	}
+	return errs
+}
+
+// HostAccess lists what in the spec of a task reaches into the worker
+// host: running a host binary with the exec runtime, bind mounting a host
+// path, or a wasm module read from the host or given a host directory as
+// its root. Such tasks are as powerful as root on the workers.
+func (t *Task) HostAccess() []string {
+	var access []string
+	if t.Runtime == "exec" {
+		access = append(access, fmt.Sprintf("exec runtime (%s)", t.Image))
+	}
+	if t.IsWasm() && !isModuleURL(t.Image) {
+		access = append(access, fmt.Sprintf("wasm module from the host (%s)", t.Image))
+	}
+	if t.IsWasm() && t.WorkingDir != "" {
+		access = append(access, fmt.Sprintf("wasm working dir %s", t.WorkingDir))
+	}
+	for _, m := range t.Mounts {
+		if m.Type == MountBind {
+			access = append(access, fmt.Sprintf("bind mount of %s", m.Source))
+		}
+	}
+	return access
+}
+
+// DefaultName names a task after its image, "docker.io/library/redis:7"
+// becoming "redis-<first 8 characters of the ID>".
+func (t *Task) DefaultName() string {
+	image := path.Base(t.Image)
+	if i := strings.IndexAny(image, ":@"); i > 0 {
+		image = image[:i]
+	}
+	image = strings.TrimSuffix(image, ".wasm")
+	return fmt.Sprintf("%s-%s", image, t.ID.String()[:8])
+}
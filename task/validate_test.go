@@ -0,0 +1,35 @@
+package task_test
+
+import (
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+func TestHostAccess(t *testing.T) {
+	tests := []struct {
+		name string
+		task task.Task
+		want int
+	}{
+		{"container", task.Task{Image: "nginx"}, 0},
+		{"volume", task.Task{Image: "nginx", Mounts: []task.Mount{{Type: task.MountVolume, Source: "data", Target: "/data"}}}, 0},
+		{"bind mount", task.Task{Image: "nginx", Mounts: []task.Mount{{Type: task.MountBind, Source: "/etc", Target: "/etc"}}}, 1},
+		{"exec", task.Task{Image: "/bin/sh", Runtime: "exec"}, 1},
+		{"wasm from a url", task.Task{Image: "https://example.com/app.wasm"}, 0},
+		{"wasm runtime from a url", task.Task{Image: "https://example.com/app", Runtime: "wasm"}, 0},
+		{"wasm from the host", task.Task{Image: "/opt/app.wasm"}, 1},
+		{"wasm runtime from the host", task.Task{Image: "app", Runtime: "wasm"}, 1},
+		{"wasm working dir", task.Task{Image: "https://example.com/app.wasm", WorkingDir: "/"}, 1},
+		{"wasm from the host with a working dir", task.Task{Image: "/opt/app.wasm", WorkingDir: "/srv"}, 2},
+		{"working dir of a container", task.Task{Image: "nginx", WorkingDir: "/srv"}, 0},
+		{"wasm image on another runtime", task.Task{Image: "app.wasm", Runtime: "docker"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.task.HostAccess(); len(got) != tt.want {
+				t.Fatalf("HostAccess() = %q, expected %d entries", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const wasmPageSize = 64 * 1024
+
+// Modules are downloaded within moduleTimeout and can't be bigger than
+// maxModuleSize, a slow or huge download would hold up the worker's queue.
+const (
+	moduleTimeout = 2 * time.Minute
+	maxModuleSize = 256 << 20
+)
+
+var moduleClient = &http.Client{Timeout: moduleTimeout}
+
+// Wasm runs WebAssembly modules inside the worker process using wazero, a
+// pure Go WASI engine. The task Image is the path or http(s) url of the
+// .wasm file, Cmd holds its arguments and the task Memory caps the linear
+// memory of the module.
+type Wasm struct {
+	LogDir  string
+	cache   wazero.CompilationCache
+	mu      sync.Mutex
+	modules map[string]*wasmModule
+}
+
+type wasmModule struct {
+	processState
+	cancel  context.CancelFunc
+	logFile string
+	done    chan struct{}
+}
+
+func NewWasm(logDir string) *Wasm {
+	return &Wasm{
+		LogDir:  logDir,
+		cache:   wazero.NewCompilationCache(),
+		modules: make(map[string]*wasmModule),
+	}
+}
+
+func (w *Wasm) Run(c Config) RuntimeResult {
+	binary, err := readModule(c.Image)
+	if err != nil {
+		log.Printf("Error reading module: %s %v\n", c.Image, err)
+		return RuntimeResult{Error: err}
+	}
+
+	err = os.MkdirAll(w.LogDir, 0700)
+	if err != nil {
+		log.Printf("Error creating log directory %s: %v\n", w.LogDir, err)
+		return RuntimeResult{Error: err}
+	}
+
+	id := strings.ReplaceAll(uuid.New().String(), "-", "")
+	logFile := filepath.Join(w.LogDir, fmt.Sprintf("%s.log", id))
+	out, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Error creating log file %s: %v\n", logFile, err)
+		return RuntimeResult{Error: err}
+	}
+
+	runtimeConfig := wazero.NewRuntimeConfig().
+		WithCompilationCache(w.cache).
+		WithCloseOnContextDone(true)
+	if c.Memory > 0 {
+		runtimeConfig = runtimeConfig.WithMemoryLimitPages(wasmMemoryPages(c.Memory))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+
+	compiled, err := r.CompileModule(ctx, binary)
+	if err != nil {
+		cancel()
+		r.Close(context.Background())
+		out.Close()
+		log.Printf("Error compiling module: %s %v\n", c.Image, err)
+		return RuntimeResult{Error: err}
+	}
+
+	moduleConfig := wazero.NewModuleConfig().
+		WithName(c.Name).
+		WithArgs(append([]string{filepath.Base(c.Image)}, c.Cmd...)...).
+		WithStdout(out).
+		WithStderr(out).
+		WithSysWalltime().
+		WithSysNanotime()
+	for _, env := range c.Env {
+		k, v, _ := strings.Cut(env, "=")
+		moduleConfig = moduleConfig.WithEnv(k, v)
+	}
+	fsConfig, err := wasmFSConfig(c)
+	if err != nil {
+		cancel()
+		r.Close(context.Background())
+		out.Close()
+		log.Printf("Error parsing mounts for %s %v\n", c.Name, err)
+		return RuntimeResult{Error: err}
+	}
+	moduleConfig = moduleConfig.WithFSConfig(fsConfig)
+
+	m := &wasmModule{
+		processState: processState{
+			ID:        id,
+			Config:    c,
+			Status:    StatusRunning,
+			StartTime: time.Now().UTC(),
+		},
+		cancel:  cancel,
+		logFile: logFile,
+		done:    make(chan struct{}),
+	}
+
+	w.mu.Lock()
+	w.modules[id] = m
+	w.mu.Unlock()
+
+	go func() {
+		_, err := r.InstantiateModule(ctx, compiled, moduleConfig)
+		out.Close()
+		r.Close(context.Background())
+
+		w.mu.Lock()
+		m.Status = StatusExited
+		m.FinishTime = time.Now().UTC()
+		var exitErr *sys.ExitError
+		switch {
+		case err == nil:
+			m.ExitCode = 0
+		case errors.As(err, &exitErr):
+			m.ExitCode = int(exitErr.ExitCode())
+		default:
+			m.ExitCode = 1
+			m.Error = err.Error()
+		}
+		w.mu.Unlock()
+
+		close(m.done)
+	}()
+
+	return RuntimeResult{
+		ContainerId: id,
+		Action:      "start",
+		Result:      "success",
+	}
+}
+
+// wasmMemoryPages turns a memory limit in bytes into wasm pages, at least
+// one and no more than the 4GiB a 32 bit module can address.
+func wasmMemoryPages(memory int64) uint32 {
+	pages := memory / wasmPageSize
+	if pages < 1 {
+		pages = 1
+	}
+	if pages > 65536 {
+		pages = 65536
+	}
+	return uint32(pages)
+}
+
+// wasmFSConfig exposes the working dir of the task as the root of the
+// module filesystem and bind mounts as directories under it. Volumes and
+// tmpfs have no meaning without a container engine behind them.
+func wasmFSConfig(c Config) (wazero.FSConfig, error) {
+	fsConfig := wazero.NewFSConfig()
+	if c.WorkingDir != "" {
+		fsConfig = fsConfig.WithDirMount(c.WorkingDir, "/")
+	}
+	for _, m := range c.Mounts {
+		if m.Type != MountBind {
+			return nil, fmt.Errorf("only bind mounts are supported by the wasm runtime")
+		}
+		if !filepath.IsAbs(m.Source) || !filepath.IsAbs(m.Target) {
+			return nil, fmt.Errorf("bind mount %s:%s must use absolute paths", m.Source, m.Target)
+		}
+		if m.ReadOnly {
+			fsConfig = fsConfig.WithReadOnlyDirMount(m.Source, m.Target)
+		} else {
+			fsConfig = fsConfig.WithDirMount(m.Source, m.Target)
+		}
+	}
+	return fsConfig, nil
+}
+
+func isModuleURL(image string) bool {
+	return strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://")
+}
+
+func readModule(image string) ([]byte, error) {
+	if !isModuleURL(image) {
+		return os.ReadFile(image)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), moduleTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, image, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := moduleClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading %s: %s", image, resp.Status)
+	}
+	if resp.ContentLength > maxModuleSize {
+		return nil, fmt.Errorf("module %s is bigger than %d bytes", image, maxModuleSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxModuleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxModuleSize {
+		return nil, fmt.Errorf("module %s is bigger than %d bytes", image, maxModuleSize)
+	}
+	return data, nil
+}
+
+func (w *Wasm) get(id string) (*wasmModule, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	m, ok := w.modules[id]
+	if !ok {
+		return nil, fmt.Errorf("no such module: %s", id)
+	}
+	return m, nil
+}
+
+func (w *Wasm) Stop(id string) RuntimeResult {
+	log.Printf("attempting to stop module: %v\n", id)
+	m, err := w.get(id)
+	if err != nil {
+		return RuntimeResult{Error: err}
+	}
+
+	m.cancel()
+	<-m.done
+
+	return RuntimeResult{
+		ContainerId: id,
+		Action:      "stop",
+		Result:      "success",
+	}
+}
+
+// Remove forgets a module, stopping it first if needed, and deletes its
+// log file. Stopped modules keep their logs until then.
+func (w *Wasm) Remove(id string) error {
+	m, err := w.get(id)
+	if err != nil {
+		return err
+	}
+	result := w.Stop(id)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	w.mu.Lock()
+	delete(w.modules, id)
+	w.mu.Unlock()
+	return os.Remove(m.logFile)
+}
+
+func (w *Wasm) Inspect(id string) InspectResult {
+	m, err := w.get(id)
+	if err != nil {
+		log.Printf("Failed to inspect module %v\n", id)
+		return InspectResult{Error: err}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return m.inspect()
+}
+
+func (w *Wasm) Logs(id string, opts LogsOptions) (io.ReadCloser, error) {
+	m, err := w.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return openLog(m.logFile, opts, m.done)
+}
+
+func (w *Wasm) List() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ids := make([]string, 0, len(w.modules))
+	for id := range w.modules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,73 @@
+package task_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhonnyV-V/orch-in-go/task"
+)
+
+// twoPages is a module without code that asks for two pages of memory.
+var twoPages = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x05, 0x03, 0x01, 0x00, 0x02,
+}
+
+func TestWasmMemoryPages(t *testing.T) {
+	tests := []struct {
+		memory int64
+		want   uint32
+	}{
+		{1, 1},
+		{64 * 1024, 1},
+		{64*1024 + 1, 1},
+		{128 * 1024, 2},
+		{4 << 30, 65536},
+		{1 << 40, 65536},
+	}
+	for _, tt := range tests {
+		if got := task.WasmMemoryPages(tt.memory); got != tt.want {
+			t.Errorf("%d bytes gave %d pages, expected %d", tt.memory, got, tt.want)
+		}
+	}
+}
+
+func TestWasmModulesGetTheirMemoryLimit(t *testing.T) {
+	dir := t.TempDir()
+	module := filepath.Join(dir, "app.wasm")
+	if err := os.WriteFile(module, twoPages, 0600); err != nil {
+		t.Fatal(err)
+	}
+	w := task.NewWasm(filepath.Join(dir, "logs"))
+
+	if result := w.Run(task.Config{Name: "small", Image: module, Memory: 64 * 1024}); result.Error == nil {
+		t.Fatal("module asking for two pages ran with one")
+	}
+	result := w.Run(task.Config{Name: "fits", Image: module, Memory: 128 * 1024})
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	state := waitExited(t, w, result.ContainerId)
+	if state.ExitCode != 0 || state.Error != "" {
+		t.Fatalf("module exited with %d: %s", state.ExitCode, state.Error)
+	}
+}
+
+func TestWasmOnlyBindMountsAbsolutePaths(t *testing.T) {
+	tests := map[string]task.Mount{
+		"volume":          {Type: task.MountVolume, Source: "data", Target: "/data"},
+		"tmpfs":           {Type: task.MountTmpfs, Target: "/tmp"},
+		"relative source": {Type: task.MountBind, Source: "data", Target: "/data"},
+		"relative target": {Type: task.MountBind, Source: "/data", Target: "data"},
+	}
+	for name, m := range tests {
+		if _, err := task.WasmFSConfig(task.Config{Mounts: []task.Mount{m}}); err == nil {
+			t.Errorf("%s mount was accepted", name)
+		}
+	}
+	_, err := task.WasmFSConfig(task.Config{Mounts: []task.Mount{{Type: task.MountBind, Source: "/data", Target: "/data", ReadOnly: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
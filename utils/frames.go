@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// ExecProtocol is the name used in the Upgrade header of exec requests.
+// Once upgraded both sides exchange frames laid out like the docker attach
+// stream: one byte for the stream, three zero bytes, the payload length as
+// a big endian uint32 and then the payload.
+const ExecProtocol = "cube-exec"
+
+const (
+	StreamStdin byte = iota
+	StreamStdout
+	StreamStderr
+	// StreamExit carries the exit code of the command in decimal, it is
+	// the last frame sent by the server.
+	StreamExit
+)
+
+const frameHeaderLen = 8
+
+func WriteFrame(w io.Writer, stream byte, p []byte) error {
+	header := make([]byte, frameHeaderLen)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(p)))
+	_, err := w.Write(append(header, p...))
+	return err
+}
+
+func ReadFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, frameHeaderLen)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[4:])
+	if size > 1<<24 {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", size)
+	}
+	p := make([]byte, size)
+	_, err = io.ReadFull(r, p)
+	if err != nil {
+		return 0, nil, err
+	}
+	return header[0], p, nil
+}
+
+func WriteExitFrame(w io.Writer, code int) error {
+	return WriteFrame(w, StreamExit, []byte(strconv.Itoa(code)))
+}
+
+// FrameWriter turns every write into a frame on a stream. Writers sharing
+// the same underlying connection must share the same lock.
+type FrameWriter struct {
+	W      io.Writer
+	Stream byte
+	Mu     *sync.Mutex
+}
+
+func (f *FrameWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	err := WriteFrame(f.W, f.Stream, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+)
+
+// StreamResponse copies r into w flushing after every read, so clients
+// following a stream get the data as soon as it is produced.
+func StreamResponse(w http.ResponseWriter, r io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			_, werr := w.Write(buf[:n])
+			if werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package worker
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jhonnyV-V/orch-in-go/auth"
 )
 
 type ErrResponse struct {
@@ -17,22 +19,42 @@ type Api struct {
 	Port    int
 	Worker  *Worker
 	Router  *chi.Mux
+	// Auth checks the token of every request, nil lets anyone in
+	Auth *auth.Authenticator
+	// TLS makes the API serve https, nil serves plain http
+	TLS *tls.Config
 }
 
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
+	a.Router.Use(a.Auth.Middleware)
 	a.Router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+			r.Post("/exec", a.ExecTaskHandler)
 		})
 	})
 	a.Router.Route("/stats", func(r chi.Router) {
 		r.Get("/", a.GetStatsHandler)
 	})
 }
+func (a *Api) Handler() http.Handler {
+	if a.Router == nil {
+		a.initRouter()
+	}
+	return a.Router
+}
+
 func (a *Api) Start() {
 	a.initRouter()
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	addr := fmt.Sprintf("%s:%d", a.Address, a.Port)
+	if a.TLS == nil {
+		http.ListenAndServe(addr, a.Router)
+		return
+	}
+	server := &http.Server{Addr: addr, Handler: a.Router, TLSConfig: a.TLS}
+	server.ListenAndServeTLS("", "")
 }
@@ -1,14 +1,21 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/auth"
 	"github.com/jhonnyV-V/orch-in-go/task"
+	"github.com/jhonnyV-V/orch-in-go/utils"
 )
 
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -28,6 +35,22 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the manager's token needs to be an admin one for these
+	if id := auth.FromContext(r.Context()); id != nil && !auth.Allows(id.Role, auth.RoleAdmin) {
+		if access := taskEvent.Task.HostAccess(); len(access) > 0 {
+			msg := fmt.Sprintf("%s (%s) can't run tasks with %s, it needs the %s role", id.Name, id.Role, strings.Join(access, ", "), auth.RoleAdmin)
+			log.Println(msg)
+			w.WriteHeader(403)
+			json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 403, Message: msg})
+			return
+		}
+	}
+
+	// known right away, so it can be stopped before it is picked from
+	// the queue
+	if _, err := a.Worker.Db.Get(taskEvent.Task.ID); err != nil {
+		a.Worker.Db.Put(taskEvent.Task.ID, &taskEvent.Task)
+	}
 	a.Worker.AddTask(taskEvent.Task)
 	log.Printf("added task %v\n", taskEvent.Task.ID)
 	w.WriteHeader(201)
@@ -58,6 +81,19 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// purging forgets the task right away instead of queueing a stop
+	if r.URL.Query().Get("purge") == "true" {
+		err = a.Worker.PurgeTask(*taskToStop.(*task.Task))
+		if err != nil {
+			log.Printf("Error purging task %v: %v\n", tId, err)
+			w.WriteHeader(500)
+			return
+		}
+		log.Printf("purged task %v\n", tId)
+		w.WriteHeader(204)
+		return
+	}
+
 	taskCopy := *(taskToStop.(*task.Task))
 	taskCopy.State = task.COMPLETED
 	a.Worker.AddTask(taskCopy)
@@ -70,3 +106,170 @@ func (a *Api) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 	json.NewEncoder(w).Encode(a.Worker.Stats)
 }
+
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tId, err := uuid.Parse(taskID)
+	if err != nil {
+		msg := fmt.Sprintf("invalid task id %s: %v", taskID, err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	result, err := a.Worker.Db.Get(tId)
+	if err != nil {
+		log.Printf("No task with id %v found\n", tId)
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
+
+	query := r.URL.Query()
+	opts := task.LogsOptions{
+		Follow: query.Get("follow") == "true",
+		Tail:   query.Get("tail"),
+		Since:  query.Get("since"),
+	}
+
+	logs, err := a.Worker.TaskLogs(*result.(*task.Task), opts)
+	if errors.Is(err, task.ErrSinceUnsupported) {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: err.Error()})
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Error getting logs for task %v: %v", tId, err)
+		log.Println(msg)
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: msg})
+		return
+	}
+	defer logs.Close()
+
+	// a blocked follow only notices the client went away once the logs
+	// are closed under it
+	go func() {
+		<-r.Context().Done()
+		logs.Close()
+	}()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+	utils.StreamResponse(w, logs)
+}
+
+type ExecRequest struct {
+	Cmd   []string
+	Tty   bool
+	Stdin bool
+}
+
+// ExecTaskHandler runs a command inside a task. The request has to ask for
+// an upgrade to utils.ExecProtocol, after which the connection carries
+// stdin frames from the client and stdout, stderr and exit frames back.
+func (a *Api) ExecTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tId, err := uuid.Parse(taskID)
+	if err != nil {
+		msg := fmt.Sprintf("invalid task id %s: %v", taskID, err)
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	if r.Header.Get("Upgrade") != utils.ExecProtocol {
+		msg := fmt.Sprintf("exec requires an upgrade to %s", utils.ExecProtocol)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	execRequest := ExecRequest{}
+	err = json.NewDecoder(r.Body).Decode(&execRequest)
+	if err != nil || len(execRequest.Cmd) == 0 {
+		msg := fmt.Sprintf("Error unmarshalling body: %v", err)
+		if err == nil {
+			msg = "no command to run"
+		}
+		log.Println(msg)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 400, Message: msg})
+		return
+	}
+
+	result, err := a.Worker.Db.Get(tId)
+	if err != nil {
+		log.Printf("No task with id %v found\n", tId)
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 404, Message: err.Error()})
+		return
+	}
+	t := *result.(*task.Task)
+	if t.State != task.RUNNING {
+		msg := fmt.Sprintf("task %v is not running", tId)
+		w.WriteHeader(409)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 409, Message: msg})
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		msg := fmt.Sprintf("unable to hijack connection: %v", err)
+		log.Println(msg)
+		w.WriteHeader(500)
+		json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 500, Message: msg})
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", utils.ExecProtocol)
+	rw.Flush()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var stdin io.Reader
+	stdinReader, stdinWriter := io.Pipe()
+	if execRequest.Stdin {
+		stdin = stdinReader
+	}
+	go func() {
+		// keep reading even without stdin, a read error means the client
+		// is gone and the command has to be stopped
+		defer cancel()
+		for {
+			stream, p, err := utils.ReadFrame(rw.Reader)
+			if err != nil {
+				stdinWriter.CloseWithError(err)
+				return
+			}
+			if stream != utils.StreamStdin {
+				continue
+			}
+			if len(p) == 0 {
+				stdinWriter.Close()
+				continue
+			}
+			stdinWriter.Write(p)
+		}
+	}()
+
+	mu := &sync.Mutex{}
+	stdout := &utils.FrameWriter{W: conn, Stream: utils.StreamStdout, Mu: mu}
+	stderr := &utils.FrameWriter{W: conn, Stream: utils.StreamStderr, Mu: mu}
+
+	log.Printf("running %v in task %v\n", execRequest.Cmd, tId)
+	opts := task.ExecOptions{Cmd: execRequest.Cmd, Tty: execRequest.Tty}
+	code, err := a.Worker.ExecTask(ctx, t, opts, stdin, stdout, stderr)
+	if err != nil {
+		log.Printf("Error running exec in task %v: %v\n", tId, err)
+		stderr.Write([]byte(err.Error() + "\n"))
+	}
+
+	mu.Lock()
+	utils.WriteExitFrame(conn, code)
+	mu.Unlock()
+}
@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/jhonnyV-V/orch-in-go/node"
+	"github.com/jhonnyV-V/orch-in-go/stats"
+)
+
+const (
+	joinRetryInterval = 5 * time.Second
+	heartbeatInterval = 10 * time.Second
+)
+
+// Registration describes the worker to the manager, its capacity is read
+// from the machine it runs on.
+func (w *Worker) Registration(address string, labels map[string]string) node.Registration {
+	r := node.Registration{
+		Name:    w.Name,
+		Address: address,
+		Cores:   runtime.NumCPU(),
+		Labels:  labels,
+	}
+	s := stats.GetStats()
+	if s.MemStats != nil {
+		r.Memory = int64(s.MemTotalKb())
+	}
+	if s.DiskStats != nil {
+		r.Disk = int64(s.DiskTotal())
+	}
+	return r
+}
+
+// AdvertiseAddress returns the address the manager can reach the worker
+// API at. A worker listening on every interface advertises the address of
+// the one it reaches the manager through.
+func AdvertiseAddress(host string, port int, manager string) (string, error) {
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+	// nothing is sent over udp, dialing only picks the route
+	conn, err := net.Dial("udp", manager)
+	if err != nil {
+		return "", fmt.Errorf("unable to find the address to advertise, use --advertise: %v", err)
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr)
+	return net.JoinHostPort(local.IP.String(), strconv.Itoa(port)), nil
+}
+
+// Join registers the worker with the manager at managerURL. It keeps
+// trying while the manager can't be reached, but gives up when the
+// manager refuses the registration.
+func Join(client *http.Client, managerURL string, r node.Registration) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/nodes/register", managerURL)
+	for {
+		resp, err := client.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Printf("unable to reach manager %s to join, retrying: %v\n", managerURL, err)
+			time.Sleep(joinRetryInterval)
+			continue
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			e := ErrResponse{}
+			json.NewDecoder(resp.Body).Decode(&e)
+			return fmt.Errorf("manager refused to register worker (%d): %s", resp.StatusCode, e.Message)
+		}
+		log.Printf("worker %s joined manager %s as %s\n", r.Name, managerURL, r.Address)
+		return nil
+	}
+}
+
+// SendHeartbeats tells the manager the worker is alive every
+// heartbeatInterval.
+func (w *Worker) SendHeartbeats(client *http.Client, managerURL string, r node.Registration) {
+	for {
+		time.Sleep(heartbeatInterval)
+		err := w.SendHeartbeat(client, managerURL, r)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// SendHeartbeat sends a single heartbeat. A manager that forgot the
+// worker, because it restarted, gets the registration again.
+func (w *Worker) SendHeartbeat(client *http.Client, managerURL string, r node.Registration) error {
+	url := fmt.Sprintf("%s/nodes/heartbeat", managerURL)
+	data, err := json.Marshal(node.Heartbeat{Name: r.Name, Address: r.Address, TaskCount: w.TaskCount})
+	if err != nil {
+		return fmt.Errorf("unable to marshal heartbeat: %v", err)
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("unable to send heartbeat to %s: %v", managerURL, err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		log.Printf("manager %s doesn't know worker %s, registering again\n", managerURL, r.Name)
+		return Join(client, managerURL, r)
+	default:
+		return fmt.Errorf("heartbeat refused by %s (%d)", managerURL, resp.StatusCode)
+	}
+}
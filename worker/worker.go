@@ -1,8 +1,13 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/golang-collections/collections/queue"
@@ -18,12 +23,23 @@ type Worker struct {
 	Db        storage.Storage
 	Stats     *stats.Stats
 	TaskCount int
+	// Runtime runs the tasks that don't ask for a specific runtime,
+	// Runtimes holds the ones that can be requested by name.
+	Runtime  task.Runtime
+	Runtimes map[string]task.Runtime
 }
 
 func New(name, dbType string) *Worker {
+	docker := task.NewDocker()
 	w := &Worker{
-		Name:  name,
-		Queue: *queue.New(),
+		Name:    name,
+		Queue:   *queue.New(),
+		Runtime: docker,
+		Runtimes: map[string]task.Runtime{
+			"docker": docker,
+			"exec":   task.NewExec(filepath.Join(os.TempDir(), "cube", name)),
+			"wasm":   task.NewWasm(filepath.Join(os.TempDir(), "cube", name)),
+		},
 	}
 
 	var s storage.Storage
@@ -87,12 +103,24 @@ func (w *Worker) RunTasks() {
 
 }
 
-func (w *Worker) runTask() task.DockerResult {
+// Step processes everything in the queue and refreshes the state of the
+// running tasks once, without sleeping in between.
+func (w *Worker) Step() {
+	for w.Queue.Len() != 0 {
+		result := w.runTask()
+		if result.Error != nil {
+			log.Printf("Error running task: %v\n", result.Error)
+		}
+	}
+	w.updateTasks()
+}
+
+func (w *Worker) runTask() task.RuntimeResult {
 	fmt.Println("RunTask")
 	t := w.Queue.Dequeue()
 	if t == nil {
 		log.Println("No task in queue")
-		return task.DockerResult{
+		return task.RuntimeResult{
 			Error: nil,
 		}
 	}
@@ -102,7 +130,7 @@ func (w *Worker) runTask() task.DockerResult {
 	// if err != nil {
 	// 	msg := fmt.Errorf("error getting task %v from database: %v", taskQueued.ID, err)
 	// 	log.Printf("%s\n", msg.Error())
-	// 	return task.DockerResult{Error: msg}
+	// 	return task.RuntimeResult{Error: msg}
 	// }
 	taskPersisted, ok := taskResult.(*task.Task)
 
@@ -112,18 +140,20 @@ func (w *Worker) runTask() task.DockerResult {
 		if err != nil {
 			msg := fmt.Errorf("error storing task %v: %v", taskQueued.ID, err)
 			log.Printf("%s\n", msg.Error())
-			return task.DockerResult{Error: msg}
+			return task.RuntimeResult{Error: msg}
 		}
 	} else {
 	}
 
-	var result task.DockerResult
+	var result task.RuntimeResult
 	if task.ValidStateTransition(taskPersisted.State, taskQueued.State) {
 		switch taskQueued.State {
 		case task.SCHEDULED:
 			result = w.StartTask(taskQueued)
 		case task.COMPLETED:
-			result = w.StopTask(taskQueued)
+			// the stop may have been asked before the task started, the
+			// stored copy knows its container
+			result = w.StopTask(*taskPersisted)
 		default:
 			result.Error = fmt.Errorf("We should not get here")
 		}
@@ -134,12 +164,40 @@ func (w *Worker) runTask() task.DockerResult {
 	return result
 }
 
-func (w *Worker) StartTask(t task.Task) task.DockerResult {
+func (w *Worker) runtimeFor(t task.Task) (task.Runtime, error) {
+	name := t.Runtime
+	if t.IsWasm() {
+		name = "wasm"
+	}
+	if name == "" {
+		return w.Runtime, nil
+	}
+	r, ok := w.Runtimes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown runtime %s", name)
+	}
+	return r, nil
+}
+
+func (w *Worker) StartTask(t task.Task) task.RuntimeResult {
 	fmt.Println("StartTask")
 	t.StartTime = time.Now().UTC()
+	t.FinishTime = time.Time{}
+	t.ExitCode = 0
+	t.TerminationReason = ""
 	config := task.NewConfig(&t)
-	dockerTask := task.NewDocker(config)
-	result := dockerTask.Run()
+	runtime, err := w.runtimeFor(t)
+	if err != nil {
+		log.Printf("Error running task %v: %v\n", t.ID, err)
+		t.State = task.FAILED
+		w.Db.Put(t.ID, &t)
+		return task.RuntimeResult{Error: err}
+	}
+	if t.ContainerID != "" {
+		// a restart replaces what the previous run left behind
+		removeContainer(runtime, t.ContainerID)
+	}
+	result := runtime.Run(*config)
 	if result.Error != nil {
 		log.Printf("Error running task %v: %v\n", t.ID, result.Error)
 		t.State = task.FAILED
@@ -153,11 +211,15 @@ func (w *Worker) StartTask(t task.Task) task.DockerResult {
 
 	return result
 }
-func (w *Worker) StopTask(t task.Task) task.DockerResult {
+func (w *Worker) StopTask(t task.Task) task.RuntimeResult {
 	fmt.Println("StopTask")
-	config := task.NewConfig(&t)
-	dockerTask := task.NewDocker(config)
-	result := dockerTask.Stop(t.ContainerID)
+	var result task.RuntimeResult
+	runtime, err := w.runtimeFor(t)
+	if err != nil {
+		result.Error = err
+	} else {
+		result = runtime.Stop(t.ContainerID)
+	}
 	if result.Error != nil {
 		log.Printf("Error stopping container %v: %v\n", t.ContainerID, result.Error)
 	}
@@ -170,10 +232,64 @@ func (w *Worker) StopTask(t task.Task) task.DockerResult {
 	return result
 }
 
-func (w *Worker) InspectTask(t task.Task) task.DockerInspectResult {
-	config := task.NewConfig(&t)
-	d := task.NewDocker(config)
-	return d.Inspect(t.ContainerID)
+// PurgeTask stops a task if it still runs and forgets it, along with
+// everything its runtime kept around like its logs.
+func (w *Worker) PurgeTask(t task.Task) error {
+	runtime, err := w.runtimeFor(t)
+	if err != nil {
+		return err
+	}
+	if t.ContainerID != "" {
+		if t.State == task.SCHEDULED || t.State == task.RUNNING {
+			result := runtime.Stop(t.ContainerID)
+			if result.Error != nil {
+				log.Printf("Error stopping container %v: %v\n", t.ContainerID, result.Error)
+			}
+		}
+		removeContainer(runtime, t.ContainerID)
+	}
+	return w.Db.Delete(t.ID)
+}
+
+func removeContainer(runtime task.Runtime, id string) {
+	remover, ok := runtime.(task.Remover)
+	if !ok {
+		return
+	}
+	err := remover.Remove(id)
+	if err != nil {
+		log.Printf("Error removing container %v: %v\n", id, err)
+	}
+}
+
+func (w *Worker) InspectTask(t task.Task) task.InspectResult {
+	runtime, err := w.runtimeFor(t)
+	if err != nil {
+		return task.InspectResult{Error: err}
+	}
+	return runtime.Inspect(t.ContainerID)
+}
+
+func (w *Worker) TaskLogs(t task.Task, opts task.LogsOptions) (io.ReadCloser, error) {
+	runtime, err := w.runtimeFor(t)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.Logs(t.ContainerID, opts)
+}
+
+var ErrExecUnsupported = errors.New("runtime does not support exec")
+
+func (w *Worker) ExecTask(ctx context.Context, t task.Task, opts task.ExecOptions, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	runtime, err := w.runtimeFor(t)
+	if err != nil {
+		return -1, err
+	}
+	execer, ok := runtime.(task.Execer)
+	if !ok {
+		return -1, ErrExecUnsupported
+	}
+	return execer.Exec(ctx, t.ContainerID, opts, stdin, stdout, stderr)
 }
 
 func (w *Worker) UpdateTasks() {
@@ -206,18 +322,49 @@ func (w *Worker) updateTasks() {
 			if resp.Container == nil {
 				log.Printf("No container for running task %s\n", t.ID)
 				t.State = task.FAILED
+				t.TerminationReason = task.ReasonContainerMissing
 				w.Db.Put(t.ID, t)
+				continue
 			}
 
-			if resp.Container.State.Status == "exited" {
-				log.Printf("Container for task %s in non-running state %s\n", t.ID, resp.Container.State.Status)
-				t.State = task.FAILED
+			if resp.Container.Status == task.StatusExited {
+				log.Printf("Container for task %s in non-running state %s\n", t.ID, resp.Container.Status)
+				finishTask(t, resp.Container)
 				w.Db.Put(t.ID, t)
+				continue
 			}
 
-			// task is running, update exposed ports
-			t.HostPorts = resp.Container.NetworkSettings.NetworkSettingsBase.Ports
+			// task is running, update exposed ports and disk usage
+			t.HostPorts = resp.Container.HostPorts
+			if resp.Container.DiskUsage != nil {
+				t.DiskUsage = *resp.Container.DiskUsage
+			}
 			w.Db.Put(t.ID, t)
 		}
 	}
 }
+
+// finishTask records how the container of a task exited. Services are not
+// supposed to exit so they always fail, jobs complete when they exit with 0.
+func finishTask(t *task.Task, state *task.ContainerStatus) {
+	t.ExitCode = state.ExitCode
+	t.FinishTime = time.Now().UTC()
+	if !state.FinishedAt.IsZero() {
+		t.FinishTime = state.FinishedAt
+	}
+
+	switch {
+	case state.OOMKilled:
+		t.TerminationReason = task.ReasonOOMKilled
+	case state.ExitCode == 0:
+		t.TerminationReason = task.ReasonCompleted
+	default:
+		t.TerminationReason = task.ReasonError
+	}
+
+	if t.IsJob() && state.ExitCode == 0 && !state.OOMKilled {
+		t.State = task.COMPLETED
+	} else {
+		t.State = task.FAILED
+	}
+}
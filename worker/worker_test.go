@@ -0,0 +1,169 @@
+package worker_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+	"github.com/jhonnyV-V/orch-in-go/task"
+	"github.com/jhonnyV-V/orch-in-go/worker"
+)
+
+// dockerd answers the few docker API calls the worker makes to run,
+// inspect, stop and remove containers. Like docker, it refuses to create a
+// container with the name of another one, running or not. It counts the
+// inspections that asked for the size of a container.
+type dockerd struct {
+	mu         sync.Mutex
+	containers map[string]string
+	storage    map[string]map[string]string
+	running    map[string]bool
+	sized      int
+	next       int
+}
+
+func newDockerd() *dockerd {
+	return &dockerd{
+		containers: make(map[string]string),
+		storage:    make(map[string]map[string]string),
+		running:    make(map[string]bool),
+	}
+}
+
+var apiVersion = regexp.MustCompile(`^/v[0-9.]+`)
+
+func (d *dockerd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	path := apiVersion.ReplaceAllString(r.URL.Path, "")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case path == "/images/create":
+		w.Write([]byte("{}"))
+	case path == "/containers/create":
+		name := r.URL.Query().Get("name")
+		for _, n := range d.containers {
+			if n == name {
+				apiError(w, http.StatusConflict, fmt.Sprintf("Conflict. The container name %q is already in use", "/"+name))
+				return
+			}
+		}
+		body := struct {
+			HostConfig struct{ StorageOpt map[string]string }
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		d.next++
+		id := fmt.Sprintf("container-%d", d.next)
+		d.containers[id] = name
+		d.storage[id] = body.HostConfig.StorageOpt
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"Id": id})
+	case len(parts) >= 2 && parts[0] == "containers":
+		name, ok := d.containers[parts[1]]
+		if !ok {
+			apiError(w, http.StatusNotFound, "No such container: "+parts[1])
+			return
+		}
+		switch {
+		case r.Method == "DELETE":
+			delete(d.containers, parts[1])
+			w.WriteHeader(http.StatusNoContent)
+		case len(parts) == 3 && parts[2] == "json":
+			size := ""
+			if r.URL.Query().Get("size") == "1" {
+				d.sized++
+				size = `,"SizeRw":1024`
+			}
+			status := "exited"
+			if d.running[parts[1]] {
+				status = "running"
+			}
+			storage, _ := json.Marshal(d.storage[parts[1]])
+			fmt.Fprintf(w, `{"Id":%q,"Name":%q,"Config":{"Labels":{}},"HostConfig":{"StorageOpt":%s},"State":{"Status":%q,"Running":%t}%s}`,
+				parts[1], "/"+name, storage, status, d.running[parts[1]], size)
+		case len(parts) == 3 && parts[2] == "start":
+			d.running[parts[1]] = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		apiError(w, http.StatusNotFound, fmt.Sprintf("unexpected %s %s", r.Method, path))
+	}
+}
+
+func apiError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": msg})
+}
+
+// dockerWorker runs the containers of a worker on d.
+func dockerWorker(t *testing.T, d *dockerd) *worker.Worker {
+	s := httptest.NewServer(d)
+	t.Cleanup(s.Close)
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+s.Listener.Addr().String()), client.WithVersion("1.45"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := worker.New("worker-1", "memory")
+	w.Runtime = &task.Docker{Client: cli}
+	return w
+}
+
+func TestRestartsReplaceTheDockerContainer(t *testing.T) {
+	d := newDockerd()
+	w := dockerWorker(t, d)
+	tk := task.Task{ID: uuid.New(), Name: "web", Image: "nginx", State: task.SCHEDULED}
+	result := w.StartTask(tk)
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+
+	// the container exited and the manager restarts the failed task
+	tk.ContainerID = result.ContainerId
+	tk.State = task.FAILED
+	result = w.StartTask(tk)
+	if result.Error != nil {
+		t.Fatalf("restart failed: %v", result.Error)
+	}
+	if len(d.containers) != 1 || d.containers[result.ContainerId] != "web" {
+		t.Fatalf("containers after the restart: %v", d.containers)
+	}
+}
+
+func TestOnlyTasksWithADiskLimitAreSized(t *testing.T) {
+	d := newDockerd()
+	w := dockerWorker(t, d)
+
+	for _, tk := range []task.Task{
+		{ID: uuid.New(), Name: "web", Image: "nginx", State: task.SCHEDULED},
+		{ID: uuid.New(), Name: "db", Image: "postgres", Disk: 1 << 30, State: task.SCHEDULED},
+	} {
+		result := w.StartTask(tk)
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+		tk.ContainerID = result.ContainerId
+		tk.State = task.RUNNING
+		inspected := w.InspectTask(tk)
+		if inspected.Error != nil {
+			t.Fatal(inspected.Error)
+		}
+		sized := inspected.Container.DiskUsage != nil && *inspected.Container.DiskUsage == 1024
+		if sized != (tk.Disk > 0) {
+			t.Fatalf("task %s with disk %d got its size: %v", tk.Name, tk.Disk, sized)
+		}
+	}
+	if d.sized != 1 {
+		t.Fatalf("docker was asked %d times for a size, expected 1", d.sized)
+	}
+}